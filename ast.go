@@ -0,0 +1,599 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// --------------------------- AST ---------------------------
+
+// NodeKind the kind of the expression node.
+type NodeKind uint8
+
+// The kinds of the expression node.
+const (
+	InvalidNode   NodeKind = iota
+	GroupNode              // (x), or the function argument without parentheses
+	BoolNode               // true, false
+	StringNode             // 'abc'
+	NumberNode             // 1, 0.5, 0x1f
+	NilNode                // nil
+	VariableNode           // the env variable, e.g. x
+	SelectorNode           // the field selector, e.g. $, (A.B)$, $[0], (A)$parent, (../A)$, $root
+	RangeKvNode            // the range key or element, e.g. #k, #v, ##, #v.Name
+	FuncNode               // the function call, e.g. len($), regexp('\\d', $), range($, #v>0)
+	OperatorNode           // the binary operator, e.g. A+B, A&&B
+	TernaryNode            // A ? B : C
+	SubscriptNode          // the slice or wildcard sub-selector, e.g. 1:3 of $[1:3], * of $[*]
+	LetNode                // the let-binding of the local variable, e.g. let n = len($); n > 0
+)
+
+var nodeKindNames = [...]string{
+	InvalidNode:   "invalid",
+	GroupNode:     "group",
+	BoolNode:      "bool",
+	StringNode:    "string",
+	NumberNode:    "number",
+	NilNode:       "nil",
+	VariableNode:  "variable",
+	SelectorNode:  "selector",
+	RangeKvNode:   "rangeKv",
+	FuncNode:      "func",
+	OperatorNode:  "operator",
+	TernaryNode:   "ternary",
+	SubscriptNode: "subscript",
+	LetNode:       "let",
+}
+
+// String returns the name of the node kind.
+func (k NodeKind) String() string {
+	if int(k) < len(nodeKindNames) {
+		return nodeKindNames[k]
+	}
+	return "NodeKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// KindOf returns the kind of the expression node.
+func KindOf(node ExprNode) NodeKind {
+	switch e := node.(type) {
+	case *constExprNode:
+		return KindOf(e.orig)
+	case *groupExprNode:
+		return GroupNode
+	case *boolExprNode:
+		return BoolNode
+	case *stringExprNode:
+		return StringNode
+	case *digitalExprNode:
+		return NumberNode
+	case *nilExprNode:
+		return NilNode
+	case *variableExprNode:
+		return VariableNode
+	case *selectorExprNode:
+		return SelectorNode
+	case *rangeKvExprNode:
+		return RangeKvNode
+	case *funcExprNode, *regexpFuncExprNode, *sprintfFuncExprNode, *rangeFuncExprNode, *collectionFuncExprNode:
+		return FuncNode
+	case *ternaryExprNode:
+		return TernaryNode
+	case *subscriptExprNode:
+		return SubscriptNode
+	case *letExprNode:
+		return LetNode
+	case *additionExprNode, *multiplicationExprNode, *divisionExprNode, *subtractionExprNode, *remainderExprNode,
+		*bitAndExprNode, *bitOrExprNode, *bitXorExprNode, *bitClearExprNode, *shiftLeftExprNode, *shiftRightExprNode,
+		*equalExprNode, *notEqualExprNode, *greaterExprNode, *greaterEqualExprNode, *lessExprNode, *lessEqualExprNode,
+		*andExprNode, *orExprNode:
+		return OperatorNode
+	}
+	return InvalidNode
+}
+
+// NodeName returns the name of the expression node:
+// the field of SelectorNode, which is empty for the current field or the whole $root/$parent struct,
+// and relative to the struct selected by $root, $parent or ../, e.g. A of (../A)$;
+// the function name of FuncNode; the operator of OperatorNode;
+// the variable name of VariableNode and LetNode; the key and field path of RangeKvNode, e.g. #v.Name;
+// otherwise, empty.
+func NodeName(node ExprNode) string {
+	switch e := node.(type) {
+	case *constExprNode:
+		return NodeName(e.orig)
+	case *selectorExprNode:
+		return e.field
+	case *funcExprNode:
+		return e.name
+	case *regexpFuncExprNode:
+		return "regexp"
+	case *sprintfFuncExprNode:
+		return "sprintf"
+	case *rangeFuncExprNode:
+		return "range"
+	case *collectionFuncExprNode:
+		return e.name
+	case *variableExprNode:
+		return e.val
+	case *letExprNode:
+		return e.name
+	case *rangeKvExprNode:
+		return e.String()
+	}
+	if KindOf(node) == OperatorNode {
+		return node.String()
+	}
+	return ""
+}
+
+// SetNodeName renames the field of SelectorNode or the variable of VariableNode,
+// and returns false for the other nodes.
+// NOTE:
+//
+//	The empty field selects the current field.
+func SetNodeName(node ExprNode, name string) bool {
+	switch e := node.(type) {
+	case *selectorExprNode:
+		e.field = name
+		return true
+	case *variableExprNode:
+		e.val = name
+		return true
+	}
+	return false
+}
+
+// NodeValue returns the literal value of BoolNode, StringNode, NumberNode or NilNode,
+// the pattern of regexp() and the format of sprintf().
+// NOTE:
+//
+//	The value of the literal with '!' is bool, e.g. !0 is true;
+//	The number value is int64, uint64 or float64.
+func NodeValue(node ExprNode) interface{} {
+	switch e := node.(type) {
+	case *constExprNode:
+		return NodeValue(e.orig)
+	case *boolExprNode:
+		return e.val
+	case *stringExprNode:
+		return e.val
+	case *digitalExprNode:
+		return e.val
+	case *nilExprNode:
+		return e.val
+	case *regexpFuncExprNode:
+		return e.re.String()
+	case *sprintfFuncExprNode:
+		return e.format
+	}
+	return nil
+}
+
+// Children returns the child nodes of the expression node in source order,
+// i.e. the operands, the function arguments, the selector subscripts and the ternary branches.
+// NOTE:
+//
+//	The function arguments and the ternary branches are GroupNode without parentheses.
+func Children(node ExprNode) []ExprNode {
+	if node == nil {
+		return nil
+	}
+	if c, ok := node.(*constExprNode); ok {
+		// the folded constant
+		node = c.orig
+	}
+	if e, ok := node.(*ternaryExprNode); ok {
+		a := []ExprNode{e.LeftOperand()}
+		if b := e.RightOperand(); b != nil {
+			a = append(a, b.LeftOperand(), b.RightOperand())
+		}
+		return a
+	}
+	return childrenOf(node)
+}
+
+// Visitor visits the expression nodes by Walk.
+type Visitor interface {
+	// Visit visits @node, and Walk visits the children of @node with the returned visitor w,
+	// followed by w.Visit(nil), if w is not nil.
+	Visit(node ExprNode) (w Visitor)
+}
+
+// Walk traverses the expression tree in depth-first order, like go/ast.Walk.
+func Walk(v Visitor, node ExprNode) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	for _, child := range Children(node) {
+		if child != nil {
+			Walk(v, child)
+		}
+	}
+	v.Visit(nil)
+}
+
+type inspector func(ExprNode) bool
+
+func (f inspector) Visit(node ExprNode) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the expression tree in depth-first order, like go/ast.Inspect:
+// it calls f(node), and if f returns true, inspects the children of node, followed by f(nil).
+func Inspect(node ExprNode, f func(ExprNode) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite replaces the nodes of the expression tree in place, from the leaves up to @node,
+// with the results of @fn, and returns the new root.
+// NOTE:
+//
+//	@fn returns the replacement of the node, or the node itself to keep it;
+//	The replacement can be the root of another compiled Program;
+//	To evaluate the rewritten tree, compile Format(root) again.
+func Rewrite(node ExprNode, fn func(ExprNode) ExprNode) ExprNode {
+	if node == nil {
+		return nil
+	}
+	if c, ok := node.(*constExprNode); ok {
+		// the folded constant is restored, since its operands may be replaced
+		node = c.orig
+	}
+	rewriteChildren(node, fn)
+	r := fn(node)
+	if r == nil {
+		return node
+	}
+	if r != node {
+		r.SetParent(node.Parent())
+	}
+	return r
+}
+
+func rewriteChildren(node ExprNode, fn func(ExprNode) ExprNode) {
+	rewrite := func(parent, e ExprNode) ExprNode {
+		if e == nil {
+			return nil
+		}
+		r := Rewrite(e, fn)
+		r.SetParent(parent)
+		return r
+	}
+	switch e := node.(type) {
+	case *funcExprNode:
+		for i, arg := range e.args {
+			e.args[i] = rewrite(e, arg)
+		}
+	case *sprintfFuncExprNode:
+		for i, arg := range e.args {
+			e.args[i] = rewrite(e, arg)
+		}
+	case *selectorExprNode:
+		for i, sub := range e.subExprs {
+			e.subExprs[i] = rewrite(e, sub)
+		}
+	case *regexpFuncExprNode:
+		if e.pattern != nil {
+			e.pattern = rewrite(e, e.pattern)
+		}
+	case *rangeFuncExprNode:
+		e.object = rewrite(e, e.object)
+		e.elemExprNode = rewrite(e, e.elemExprNode)
+	case *collectionFuncExprNode:
+		e.object = rewrite(e, e.object)
+		e.elemExprNode = rewrite(e, e.elemExprNode)
+	case *ternaryExprNode:
+		e.SetLeftOperand(rewrite(e, e.LeftOperand()))
+		if b := e.RightOperand(); b != nil {
+			b.SetLeftOperand(rewrite(b, b.LeftOperand()))
+			b.SetRightOperand(rewrite(b, b.RightOperand()))
+		}
+		return
+	}
+	if left := node.LeftOperand(); left != nil {
+		node.SetLeftOperand(rewrite(node, left))
+	}
+	if right := node.RightOperand(); right != nil {
+		node.SetRightOperand(rewrite(node, right))
+	}
+}
+
+// cloneNode returns the deep copy of the expression tree @node,
+// which can be rewritten without changing the compiled expression.
+func cloneNode(node ExprNode) ExprNode {
+	return cloneTree(node, make(map[*letExprNode]*letExprNode))
+}
+
+// cloneTree copies @node and its children,
+// and @lets maps the copied let-bindings to their copies for the local variables.
+func cloneTree(node ExprNode, lets map[*letExprNode]*letExprNode) ExprNode {
+	if node == nil {
+		return nil
+	}
+	v := reflect.ValueOf(node).Elem()
+	c := reflect.New(v.Type())
+	c.Elem().Set(v)
+	cp := c.Interface().(ExprNode)
+	clone := func(e ExprNode) ExprNode {
+		if e == nil {
+			return nil
+		}
+		r := cloneTree(e, lets)
+		r.SetParent(cp)
+		if ce, ok := r.(*constExprNode); ok {
+			ce.orig.SetParent(cp)
+		}
+		return r
+	}
+	cloneAll := func(a []ExprNode) []ExprNode {
+		if a == nil {
+			return nil
+		}
+		b := make([]ExprNode, len(a))
+		for i, e := range a {
+			b[i] = clone(e)
+		}
+		return b
+	}
+	switch e := cp.(type) {
+	case *letExprNode:
+		lets[node.(*letExprNode)] = e
+	case *variableExprNode:
+		if le, ok := lets[e.local]; ok {
+			e.local = le
+		}
+	case *constExprNode:
+		e.orig = cloneTree(e.orig, lets)
+	case *funcExprNode:
+		e.args = cloneAll(e.args)
+	case *sprintfFuncExprNode:
+		e.args = cloneAll(e.args)
+	case *selectorExprNode:
+		e.subExprs = cloneAll(e.subExprs)
+	case *regexpFuncExprNode:
+		e.pattern = clone(e.pattern)
+	case *rangeFuncExprNode:
+		e.object = clone(e.object)
+		e.elemExprNode = clone(e.elemExprNode)
+	case *collectionFuncExprNode:
+		e.object = clone(e.object)
+		e.elemExprNode = clone(e.elemExprNode)
+	}
+	cp.SetLeftOperand(clone(cp.LeftOperand()))
+	cp.SetRightOperand(clone(cp.RightOperand()))
+	return cp
+}
+
+// Format returns the source text of the expression tree,
+// which is parsed to the equivalent expression tree.
+// NOTE:
+//
+//	The binary operators are separated by spaces, e.g. $ > 0 && len($) < 3;
+//	The parentheses are added if the rewritten tree needs them.
+func Format(node ExprNode) string {
+	var b strings.Builder
+	formatNode(&b, node)
+	return b.String()
+}
+
+func formatNode(b *strings.Builder, node ExprNode) {
+	switch e := node.(type) {
+	case nil:
+	case *constExprNode:
+		formatNode(b, e.orig)
+	case *groupExprNode:
+		writeOpposite(b, e.boolOpposite, e.signOpposite)
+		if e.paren || e.boolOpposite != nil || e.signOpposite != nil {
+			b.WriteByte('(')
+			formatNode(b, e.RightOperand())
+			b.WriteByte(')')
+		} else {
+			formatNode(b, e.RightOperand())
+		}
+	case *boolExprNode:
+		b.WriteString(strconv.FormatBool(e.val))
+	case *stringExprNode:
+		writeLiteral(b, e.val)
+	case *digitalExprNode:
+		writeLiteral(b, e.val)
+	case *nilExprNode:
+		writeLiteral(b, e.val)
+	case *variableExprNode:
+		writeOpposite(b, e.boolOpposite, nil)
+		b.WriteString(e.val)
+	case *selectorExprNode:
+		writeOpposite(b, e.boolOpposite, e.signOpposite)
+		if e.field != "" {
+			b.WriteString("(" + strings.Repeat("../", e.up) + e.field + ")")
+		}
+		b.WriteString(e.name)
+		for _, sub := range e.subExprs {
+			b.WriteByte('[')
+			formatNode(b, sub)
+			b.WriteByte(']')
+		}
+	case *rangeKvExprNode:
+		writeOpposite(b, e.boolOpposite, e.signOpposite)
+		b.WriteString(e.String())
+	case *funcExprNode:
+		writeOpposite(b, e.boolOpposite, e.signOpposite)
+		writeCall(b, e.name, e.args...)
+	case *regexpFuncExprNode:
+		if e.boolOpposite {
+			b.WriteByte('!')
+		}
+		b.WriteString("regexp(")
+		if e.pattern != nil {
+			formatNode(b, e.pattern)
+		} else {
+			writeQuoted(b, e.re.String())
+		}
+		if arg := e.RightOperand(); arg != nil {
+			b.WriteString(", ")
+			formatNode(b, arg)
+		}
+		b.WriteByte(')')
+	case *sprintfFuncExprNode:
+		b.WriteString("sprintf(")
+		writeQuoted(b, e.format)
+		for _, arg := range e.args {
+			b.WriteString(", ")
+			formatNode(b, arg)
+		}
+		b.WriteByte(')')
+	case *rangeFuncExprNode:
+		writeOpposite(b, e.boolOpposite, e.signOpposite)
+		writeCall(b, "range", e.object, e.elemExprNode)
+	case *collectionFuncExprNode:
+		writeOpposite(b, e.boolOpposite, e.signOpposite)
+		if e.elemExprNode == nil {
+			writeCall(b, e.name, e.object)
+		} else {
+			writeCall(b, e.name, e.object, e.elemExprNode)
+		}
+	case *letExprNode:
+		b.WriteString("let " + e.name + " = ")
+		formatNode(b, e.LeftOperand())
+		b.WriteString("; ")
+		formatNode(b, e.RightOperand())
+	case *subscriptExprNode:
+		if e.wildcard {
+			b.WriteByte('*')
+			return
+		}
+		formatNode(b, e.LeftOperand())
+		b.WriteByte(':')
+		formatNode(b, e.RightOperand())
+	case *ternaryExprNode:
+		writeOperand(b, e, e.LeftOperand(), false)
+		b.WriteString(" ? ")
+		if br := e.RightOperand(); br != nil {
+			writeOperand(b, e, br.LeftOperand(), true)
+			b.WriteString(" : ")
+			writeOperand(b, e, br.RightOperand(), true)
+		}
+	default:
+		if KindOf(node) != OperatorNode {
+			b.WriteString(node.String())
+			return
+		}
+		writeOperand(b, node, node.LeftOperand(), false)
+		b.WriteString(" " + node.String() + " ")
+		writeOperand(b, node, node.RightOperand(), true)
+	}
+}
+
+// writeOperand writes the operand of the operator @parent,
+// in parentheses if it has lower priority.
+func writeOperand(b *strings.Builder, parent, operand ExprNode, isRight bool) {
+	if c, ok := operand.(*constExprNode); ok {
+		operand = c.orig
+	}
+	if g, ok := operand.(*groupExprNode); ok && !g.paren && g.boolOpposite == nil && g.signOpposite == nil {
+		// the ternary branch
+		operand = g.RightOperand()
+	}
+	paren := false
+	if operand != nil {
+		p, q := getPriority(parent), getPriority(operand)
+		switch KindOf(operand) {
+		case OperatorNode:
+			paren = q < p || (q == p && isRight)
+		case TernaryNode:
+			paren = true
+		}
+	}
+	if paren {
+		b.WriteByte('(')
+	}
+	formatNode(b, operand)
+	if paren {
+		b.WriteByte(')')
+	}
+}
+
+func writeCall(b *strings.Builder, name string, args ...ExprNode) {
+	b.WriteString(name)
+	b.WriteByte('(')
+	for i, arg := range args {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		formatNode(b, arg)
+	}
+	b.WriteByte(')')
+}
+
+func writeOpposite(b *strings.Builder, boolOpposite, signOpposite *bool) {
+	if boolOpposite != nil {
+		if *boolOpposite {
+			b.WriteByte('!')
+		} else {
+			b.WriteString("!!")
+		}
+	}
+	if signOpposite != nil && *signOpposite {
+		b.WriteByte('-')
+	}
+}
+
+// writeLiteral writes the literal value, which may be converted to bool by '!'.
+func writeLiteral(b *strings.Builder, v interface{}) {
+	switch r := v.(type) {
+	case nil:
+		b.WriteString("nil")
+	case bool:
+		b.WriteString(strconv.FormatBool(r))
+	case string:
+		writeQuoted(b, r)
+	case int64:
+		b.WriteString(strconv.FormatInt(r, 10))
+	case uint64:
+		b.WriteString(strconv.FormatUint(r, 10))
+	case float64:
+		s := strconv.FormatFloat(r, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			// keep the float64 type
+			s += ".0"
+		}
+		b.WriteString(s)
+	}
+}
+
+func writeQuoted(b *strings.Builder, s string) {
+	b.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'':
+			b.WriteString(`\'`)
+		case '\\':
+			// the other backslashes are kept as is, e.g. '\d'
+			if i+1 == len(s) || s[i+1] == '\\' || s[i+1] == '\'' {
+				b.WriteString(`\\`)
+			} else {
+				b.WriteByte(c)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('\'')
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr_test
+
+import (
+	"testing"
+
+	"github.com/bytedance/go-tagexpr/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspect(t *testing.T) {
+	p := tagexpr.MustCompile("(A)$>(B.C)$ && len($[(D)$])<3 ? x : count((E)$, #v.F>0)")
+	var fields, funcs []string
+	var kinds []tagexpr.NodeKind
+	tagexpr.Inspect(p.Root(), func(node tagexpr.ExprNode) bool {
+		if node == nil {
+			return false
+		}
+		kind := tagexpr.KindOf(node)
+		kinds = append(kinds, kind)
+		switch kind {
+		case tagexpr.SelectorNode:
+			fields = append(fields, tagexpr.NodeName(node))
+		case tagexpr.FuncNode:
+			funcs = append(funcs, tagexpr.NodeName(node))
+		}
+		return true
+	})
+	assert.Equal(t, []string{"A", "B.C", "", "D", "E"}, fields)
+	assert.Equal(t, []string{"len", "count"}, funcs)
+	assert.Equal(t, tagexpr.TernaryNode, kinds[0])
+	assert.Equal(t, "ternary", kinds[0].String())
+	assert.Equal(t, "&&", tagexpr.NodeName(p.Root().LeftOperand()))
+	assert.Equal(t, int64(3), tagexpr.NodeValue(p.Root().LeftOperand().RightOperand().RightOperand()))
+
+	// skip the children
+	var n int
+	tagexpr.Inspect(p.Root(), func(node tagexpr.ExprNode) bool {
+		if node != nil {
+			n++
+		}
+		return tagexpr.KindOf(node) != tagexpr.FuncNode
+	})
+	assert.Equal(t, 12, n)
+}
+
+func TestFormat(t *testing.T) {
+	var cases = []struct {
+		src    string
+		output string
+	}{
+		{src: "$>(B)$ && len((C)$)<3", output: "$ > (B)$ && len((C)$) < 3"},
+		{src: "max(1, (A)$)>2 ? 'big' : !in($, 'x', 'y')", output: "max(1, (A)$) > 2 ? 'big' : !in($, 'x', 'y')"},
+		{src: "!(1+2)*3 - -5 == -(A.B)$[0][(C)$]", output: "!(1 + 2) * 3 - -5 == -(A.B)$[0][(C)$]"},
+		{src: "regexp('^\\'a', $) && !regexp('b')", output: "regexp('^\\'a', $) && !regexp('b', $)"},
+		{src: "sprintf('%d-%s', 1, 'it\\'s')", output: "sprintf('%d-%s', 1, 'it\\'s')"},
+		{src: "a ? (b ? 1 : 2) : c ? 3 : 4", output: "a ? (b ? 1 : 2) : (c ? 3 : 4)"},
+		{src: "range($, #v>1) || count($, #v.Name=='x') + len(unique($))", output: "range($, #v > 1) || count($, #v.Name == 'x') + len(unique($))"},
+		{src: "!!x && !nil && !0 && 1.0/2 && 0x1f", output: "!!x && true && true && 1.0 / 2 && 31"},
+		{src: "1-(2-3)", output: "1 - (2 - 3)"},
+		{src: "now()", output: "now()"},
+		{src: "len((A)$[*].B)>0&&$[-1]==$[1:][0]+len($[:n-1])", output: "len((A)$[*]['B']) > 0 && $[-1] == $[1:][0] + len($[:n - 1])"},
+		{src: "$root!=nil&&(../A)$==(A.B)$root[0]||(../../C)$parent>1", output: "$root != nil && (../A)$ == (A.B)$root[0] || (../../C)$parent > 1"},
+		{src: `'a\\' + 'b\\\'c' + '\d\\d'`, output: `'a\\' + 'b\\\'c' + '\d\d'`},
+		{src: `regexp('\\\d$')`, output: `regexp('\\\d$', $)`},
+		{src: "", output: ""},
+	}
+	for _, c := range cases {
+		output := tagexpr.Format(tagexpr.MustCompile(c.src).Root())
+		assert.Equal(t, c.output, output, c.src)
+		// round trip
+		assert.Equal(t, output, tagexpr.Format(tagexpr.MustCompile(output).Root()), c.src)
+	}
+
+	// the string values are kept by the round trip
+	for src, val := range map[string]interface{}{
+		`'a\\'`:    `a\`,
+		`'\\\''`:   `\'`,
+		`'\d\\\\'`: `\d\\`,
+		`'it\'s'`:  `it's`,
+	} {
+		v, err := tagexpr.MustCompile(src).Eval(nil)
+		assert.NoError(t, err, src)
+		assert.Equal(t, val, v, src)
+		v, err = tagexpr.MustCompile(tagexpr.Format(tagexpr.MustCompile(src).Root())).Eval(nil)
+		assert.NoError(t, err, src)
+		assert.Equal(t, val, v, src)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	p := tagexpr.MustCompile("(A)$+(B)$[(A)$]>0 && max((A)$, 1)>x")
+	root := tagexpr.Rewrite(p.Root(), func(node tagexpr.ExprNode) tagexpr.ExprNode {
+		switch tagexpr.KindOf(node) {
+		case tagexpr.SelectorNode:
+			if tagexpr.NodeName(node) == "A" {
+				tagexpr.SetNodeName(node, "Info.A")
+			}
+		case tagexpr.VariableNode:
+			// replace with another tree
+			return tagexpr.MustCompile("(Min)$*2").Root()
+		}
+		return node
+	})
+	src := tagexpr.Format(root)
+	assert.Equal(t, "(Info.A)$ + (B)$[(Info.A)$] > 0 && max((Info.A)$, 1) > (Min)$ * 2", src)
+	type Info struct{ A int }
+	r, err := tagexpr.MustCompile(src).Eval(map[string]interface{}{
+		"Info": Info{A: 3},
+		"B":    map[int]int{3: 1},
+		"Min":  1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, true, r)
+	assert.False(t, tagexpr.SetNodeName(root, "x"))
+
+	// Root returns a copy, so the program in use is not changed by rewriting it
+	p = tagexpr.MustCompile("(A)$ > x")
+	root = tagexpr.Rewrite(p.Root(), func(node tagexpr.ExprNode) tagexpr.ExprNode {
+		switch tagexpr.KindOf(node) {
+		case tagexpr.SelectorNode:
+			tagexpr.SetNodeName(node, "B")
+		case tagexpr.VariableNode:
+			return tagexpr.MustCompile("(Min)$").Root()
+		}
+		return node
+	})
+	assert.Equal(t, "(B)$ > (Min)$", tagexpr.Format(root))
+	assert.Equal(t, "(A)$ > x", tagexpr.Format(p.Root()))
+	r, err = p.EvalWithEnv(map[string]interface{}{"A": 2, "B": 0, "Min": 3}, map[string]interface{}{"x": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, true, r)
+
+	// the local variables of the copy refer to the copied let-bindings
+	p = tagexpr.MustCompile("let n = (A)$; n > 1")
+	root = tagexpr.Rewrite(p.Root(), func(node tagexpr.ExprNode) tagexpr.ExprNode {
+		if tagexpr.KindOf(node) == tagexpr.SelectorNode {
+			tagexpr.SetNodeName(node, "B")
+		}
+		return node
+	})
+	assert.Equal(t, "let n = (B)$; n > 1", tagexpr.Format(root))
+	assert.Equal(t, "let n = (A)$; n > 1", tagexpr.Format(p.Root()))
+}
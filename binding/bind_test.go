@@ -45,6 +45,20 @@ func TestRawBody(t *testing.T) {
 	t.Logf("%s", bodyCopied)
 }
 
+func TestTernaryMsg(t *testing.T) {
+	type Recv struct {
+		A int `query:"a" vd:"$>0 && $<100; msg:$<=0 ? 'a must be positive' : 'a too large'"`
+	}
+	binder := binding.New(nil)
+	recv := new(Recv)
+	err := binder.BindAndValidate(recv, newRequest("http://localhost:8080/?a=-1", nil, nil, nil), nil)
+	assert.EqualError(t, err, "validating: expr_path=A, cause=a must be positive")
+	err = binder.BindAndValidate(recv, newRequest("http://localhost:8080/?a=100", nil, nil, nil), nil)
+	assert.EqualError(t, err, "validating: expr_path=A, cause=a too large")
+	err = binder.BindAndValidate(recv, newRequest("http://localhost:8080/?a=10", nil, nil, nil), nil)
+	assert.NoError(t, err)
+}
+
 func TestQueryString(t *testing.T) {
 	type metric string
 	type count int32
@@ -1,11 +1,14 @@
 package binding
 
 import (
+	jsonpkg "encoding/json"
+	"fmt"
 	"net/textproto"
 	"reflect"
 	"sort"
 	"strings"
 
+	"github.com/andeya/ameda"
 	"github.com/andeya/goutil"
 )
 
@@ -101,6 +104,70 @@ func (t *Config) parse(field reflect.StructField) tagKVs {
 	return kvs
 }
 
+// CheckField checks the binding tags of the struct field statically, and returns the problems:
+// the conflicting tags, e.g. query:"-,required", and the unsupported tag values, e.g. raw_body on an int field.
+// NOTE:
+//
+//	Only the Name, Tag and Type of @field are used;
+//	If the Type is nil, the checks depending on it are skipped.
+func (t *Config) CheckField(field reflect.StructField) []error {
+	if t.list == nil {
+		t.init()
+	}
+	var errs []error
+	var rawBody, defaultVal *tagKV
+	for _, kv := range t.parse(field) {
+		switch kv.name {
+		case t.Validator:
+			continue
+		case t.defaultVal:
+			defaultVal = kv
+			continue
+		}
+		info := kv.toInfo(false)
+		if info.paramName == "-" {
+			if info.required {
+				errs = append(errs, fmt.Errorf("%s:%q omits the field, which can not be required", kv.name, kv.value))
+			}
+			continue
+		}
+		if kv.name == t.RawBody {
+			rawBody = kv
+		}
+	}
+	if rawBody != nil && defaultVal != nil {
+		errs = append(errs, fmt.Errorf("%s is never used, since %s binds the field even if the body is empty", t.defaultVal, t.RawBody))
+	}
+	if field.Type == nil {
+		return errs
+	}
+	if rawBody != nil {
+		switch st := ameda.DereferenceType(field.Type); st.Kind() {
+		case reflect.String:
+		case reflect.Slice:
+			if st.Elem().Kind() == reflect.Uint8 {
+				break
+			}
+			fallthrough
+		default:
+			errs = append(errs, fmt.Errorf("%s can not bind to the %s field, only []byte and string are supported", t.RawBody, field.Type))
+		}
+	}
+	if defaultVal != nil {
+		p := &paramInfo{
+			structField: field,
+			tagInfos:    []*tagInfo{{paramIn: default_val, paramName: defaultVal.value}},
+		}
+		if err := p.setDefaultVal(); err == nil {
+			err = jsonpkg.Unmarshal(p.defaultVal, reflect.New(ameda.DereferenceType(field.Type)).Interface())
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s:%q is invalid: %v", t.defaultVal, defaultVal.value, err))
+			}
+		}
+	}
+	return errs
+}
+
 type tagKV struct {
 	name  string
 	value string
@@ -1,6 +1,8 @@
 package binding
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,3 +32,40 @@ func TestDefaultSplitTag(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckField(t *testing.T) {
+	type T struct {
+		A []byte         `raw_body:""`
+		B int            `raw_body:"" default:"1"`
+		C string         `query:"-,required" json:"c"`
+		D int            `query:"d" default:"x"`
+		E []string       `form:"e" default:"['a','b']"`
+		F *int           `header:"f" default:"3"`
+		G map[string]int `default:"{'a':'b'}"`
+	}
+	var got = map[string][]string{}
+	rt := reflect.TypeOf(T{})
+	for i := 0; i < rt.NumField(); i++ {
+		for _, err := range new(Config).CheckField(rt.Field(i)) {
+			msg := err.Error()
+			if i := strings.Index(msg, " is invalid: json: "); i > 0 {
+				// the message of encoding/json varies with the Go version
+				msg = msg[:i+len(" is invalid")]
+			}
+			got[rt.Field(i).Name] = append(got[rt.Field(i).Name], msg)
+		}
+	}
+	assert.Equal(t, map[string][]string{
+		"B": {
+			"default is never used, since raw_body binds the field even if the body is empty",
+			"raw_body can not bind to the int field, only []byte and string are supported",
+		},
+		"C": {`query:"-,required" omits the field, which can not be required`},
+		"D": {`default:"x" is invalid: invalid character 'x' looking for beginning of value`},
+		"G": {`default:"{'a':'b'}" is invalid`},
+	}, got)
+
+	// the type dependent checks are skipped without the type
+	errs := new(Config).CheckField(reflect.StructField{Name: "B", Tag: rt.Field(1).Tag})
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,502 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andeya/ameda"
+)
+
+// --------------------------- Static check ---------------------------
+
+// DiagnosticCode the category of the problem found by VM.Check
+type DiagnosticCode string
+
+// The categories of the problems found by VM.Check.
+const (
+	// DiagUnknownSelector the field selector does not exist, e.g. (Missing.Field)$
+	DiagUnknownSelector DiagnosticCode = "unknown-selector"
+	// DiagOperandKind the operator is applied to the incompatible kind, e.g. $*2 on a string field
+	DiagOperandKind DiagnosticCode = "operand-kind"
+	// DiagArgumentKind the function argument has the incompatible kind, e.g. len($) on an int field
+	DiagArgumentKind DiagnosticCode = "argument-kind"
+	// DiagResultKind the expression result has the unexpected kind, e.g. the non-boolean validation expression
+	DiagResultKind DiagnosticCode = "result-kind"
+)
+
+// Diagnostic the problem of the struct tag expression found by VM.Check
+type Diagnostic struct {
+	// Struct the struct type name
+	Struct string
+	// Field the struct field name
+	Field string
+	// Tag the struct tag name
+	Tag string
+	// ExprName the expression name
+	ExprName string
+	// Expr the source expression
+	Expr string
+	// Offset the byte offset of the problem in Expr
+	Offset int
+	// Code the category of the problem
+	Code DiagnosticCode
+	// Msg the problem description
+	Msg string
+}
+
+// String returns the description with the location.
+func (d *Diagnostic) String() string {
+	var b strings.Builder
+	b.WriteString("struct ")
+	b.WriteString(d.Struct)
+	b.WriteString(", field ")
+	b.WriteString(d.Field)
+	b.WriteString(", tag ")
+	b.WriteString(d.Tag)
+	b.WriteString(", expr ")
+	b.WriteString(d.ExprName)
+	b.WriteString(": ")
+	b.WriteString(d.Msg)
+	b.WriteString(" at offset ")
+	b.WriteString(strconv.Itoa(d.Offset))
+	return b.String()
+}
+
+// Check checks the tag expressions of the struct type statically,
+// including the struct types of the fields, and returns the problems found.
+// NOTE:
+//
+//	@structOrType can be struct, struct pointer, reflect.Type or reflect.Value;
+//	@exprKinds specifies the expected result kinds by expression name,
+//	e.g. map[string]Kind{"@": BoolKind, "msg": StringKind};
+//	The error is returned if the struct tags can not be parsed, the same as Run.
+func (vm *VM) Check(structOrType interface{}, exprKinds ...map[string]Kind) ([]Diagnostic, error) {
+	var t reflect.Type
+	switch v := structOrType.(type) {
+	case reflect.Type:
+		t = v
+	case reflect.Value:
+		if v.IsValid() {
+			t = v.Type()
+		}
+	default:
+		t = reflect.TypeOf(v)
+	}
+	if t == nil {
+		return nil, unsupportNil
+	}
+	var kinds map[string]Kind
+	if len(exprKinds) > 0 {
+		kinds = exprKinds[0]
+	}
+	vm.rw.Lock()
+	defer vm.rw.Unlock()
+	s, err := vm.registerStructLocked(t)
+	if err != nil {
+		return nil, err
+	}
+	var diags []Diagnostic
+	visited := make(map[*structVM]bool, 8)
+	var check func(s *structVM)
+	check = func(s *structVM) {
+		if visited[s] {
+			return
+		}
+		visited[s] = true
+		for _, k := range s.fieldSelectorList {
+			f := s.fields[k]
+			if strings.Contains(k, FieldSeparator) {
+				// the field merged from the sub-struct is checked with the sub-struct
+				continue
+			}
+			diags = append(diags, s.lintField(f, kinds)...)
+		}
+		for _, k := range s.fieldSelectorList {
+			if strings.Contains(k, FieldSeparator) {
+				continue
+			}
+			for _, t := range structTypesOf(s.fields[k].elemType) {
+				if sub := vm.structJar[ameda.RuntimeTypeID(t)]; sub != nil {
+					check(sub)
+				}
+			}
+		}
+	}
+	check(s)
+	return diags, nil
+}
+
+// structTypesOf returns the struct types in @t, including the elements and keys of array, slice and map.
+func structTypesOf(t reflect.Type) []reflect.Type {
+	if t == nil {
+		return nil
+	}
+	t = derefType(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == timeType {
+			return nil
+		}
+		return []reflect.Type{t}
+	case reflect.Array, reflect.Slice:
+		return structTypesOf(t.Elem())
+	case reflect.Map:
+		return append(structTypesOf(t.Key()), structTypesOf(t.Elem())...)
+	}
+	return nil
+}
+
+// lintField checks the tag expressions of the field, and returns the problems found.
+func (s *structVM) lintField(f *fieldVM, exprKinds map[string]Kind) []Diagnostic {
+	var diags []Diagnostic
+	for _, k := range sortedExprSelectors(f) {
+		c := &kindChecker{s: s, field: f.fieldSelector, p: f.exprs[k], lint: true}
+		kind := c.kindOf(c.p.expr)
+		name := ExprSelector(k).Name()
+		if want, ok := exprKinds[name]; ok && kind != AnyKind && !want.accepts(kind) {
+			c.report(0, DiagResultKind, fmt.Sprintf("expression expects %s result, got %s", want, kind))
+		}
+		for _, d := range c.diags {
+			d.Struct = s.name
+			d.Field = f.structField.Name
+			d.Tag = s.vm.tagName
+			d.ExprName = name
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
+
+func sortedExprSelectors(f *fieldVM) []string {
+	selectors := make([]string, 0, len(f.exprs))
+	for k := range f.exprs {
+		selectors = append(selectors, k)
+	}
+	sort.Strings(selectors)
+	return selectors
+}
+
+// kindOfType returns the kind of the go type.
+func kindOfType(t reflect.Type) Kind {
+	t = derefType(t)
+	switch t {
+	case timeType:
+		return TimeKind
+	case durationType:
+		return DurationKind
+	}
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NumberKind
+	case reflect.String:
+		return StringKind
+	case reflect.Bool:
+		return BoolKind
+	case reflect.Array, reflect.Slice:
+		return ListKind
+	case reflect.Map:
+		return MapKind
+	case reflect.Struct:
+		return StructKind
+	}
+	return AnyKind
+}
+
+// kindOfValue returns the kind of the literal value.
+func kindOfValue(v interface{}) Kind {
+	if v == nil {
+		return AnyKind
+	}
+	return kindOfType(reflect.TypeOf(v))
+}
+
+// kindChecker infers the kinds of the expression nodes statically,
+// and checks the arguments of the functions with signatures.
+// NOTE:
+//
+//	If lint=false, only the function arguments are checked, and the first mismatch is the err;
+//	If lint=true, the problems are collected as diags, used by VM.Check.
+type kindChecker struct {
+	s      *structVM
+	field  string // the field selected by $
+	p      *Expr
+	err    error
+	lint   bool
+	diags  []Diagnostic
+	locals map[*letExprNode]Kind // the kinds of the let-bindings
+}
+
+// checkKinds checks the kinds of the function arguments in the tag expressions of @fields.
+func (s *structVM) checkKinds(fields []*fieldVM) error {
+	for _, f := range fields {
+		for _, k := range sortedExprSelectors(f) {
+			c := &kindChecker{s: s, field: f.fieldSelector, p: f.exprs[k]}
+			c.kindOf(c.p.expr)
+			if e, ok := c.err.(*SyntaxError); ok {
+				e.Struct = s.name
+				e.Field = f.structField.Name
+				e.Tag = s.vm.tagName
+				e.ExprName = ExprSelector(k).Name()
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// report records the problem if lint=true.
+func (c *kindChecker) report(offset int, code DiagnosticCode, msg string) {
+	if c.lint {
+		c.diags = append(c.diags, Diagnostic{Expr: c.p.src, Offset: offset, Code: code, Msg: msg})
+	}
+}
+
+// checkOperands reports the operand kinds of the operator @node which are not in @accept.
+func (c *kindChecker) checkOperands(node ExprNode, accept Kind, kinds ...Kind) {
+	for _, k := range kinds {
+		if k != AnyKind && k&^accept != 0 {
+			c.report(posOf(node), DiagOperandKind, fmt.Sprintf("operator %s expects %s, got %s", node.String(), accept, k))
+			return
+		}
+	}
+}
+
+func (c *kindChecker) kindOf(node ExprNode) Kind {
+	if node == nil || c.err != nil {
+		return AnyKind
+	}
+	switch e := node.(type) {
+	case *constExprNode:
+		return c.kindOf(e.orig)
+	case *groupExprNode:
+		k := c.kindOf(e.rightOperand)
+		if e.boolOpposite != nil {
+			return BoolKind
+		}
+		return k
+	case *boolExprNode:
+		return BoolKind
+	case *stringExprNode:
+		return kindOfValue(e.val)
+	case *digitalExprNode:
+		return kindOfValue(e.val)
+	case *nilExprNode:
+		return kindOfValue(e.val)
+	case *variableExprNode:
+		if e.boolOpposite != nil {
+			return BoolKind
+		}
+		if e.local != nil {
+			return c.locals[e.local]
+		}
+		return c.s.vm.env[e.val].Kind
+	case *letExprNode:
+		if c.locals == nil {
+			c.locals = make(map[*letExprNode]Kind)
+		}
+		c.locals[e] = c.kindOf(e.leftOperand)
+		return c.kindOf(e.rightOperand)
+	case *rangeKvExprNode:
+		if e.boolOpposite != nil {
+			return BoolKind
+		}
+		return AnyKind
+	case *selectorExprNode:
+		return c.selectorKind(e)
+	case *subscriptExprNode:
+		c.childrenKinds(e)
+		return AnyKind
+	case *funcExprNode:
+		return c.funcKind(e)
+	case *regexpFuncExprNode:
+		c.kindOf(e.pattern)
+		c.kindOf(e.rightOperand)
+		return BoolKind
+	case *sprintfFuncExprNode:
+		c.childrenKinds(e)
+		return StringKind
+	case *rangeFuncExprNode:
+		c.childrenKinds(e)
+		return ListKind
+	case *collectionFuncExprNode:
+		c.childrenKinds(e)
+		switch {
+		case e.boolOpposite != nil:
+			return BoolKind
+		case e.name == "filter" || e.name == "map":
+			return ListKind
+		case e.name == "count":
+			return NumberKind
+		}
+		return BoolKind
+	case *equalExprNode, *notEqualExprNode, *andExprNode, *orExprNode:
+		c.childrenKinds(e)
+		return BoolKind
+	case *greaterExprNode, *greaterEqualExprNode, *lessExprNode, *lessEqualExprNode:
+		l, r := c.childrenKinds(e)
+		c.checkOperands(e, NumberKind|StringKind|TimeKind|DurationKind, l, r)
+		return BoolKind
+	case *multiplicationExprNode, *divisionExprNode, *remainderExprNode:
+		l, r := c.childrenKinds(e)
+		c.checkOperands(e, NumberKind|DurationKind, l, r)
+		return NumberKind
+	case *bitAndExprNode, *bitOrExprNode, *bitXorExprNode, *bitClearExprNode,
+		*shiftLeftExprNode, *shiftRightExprNode:
+		l, r := c.childrenKinds(e)
+		c.checkOperands(e, NumberKind, l, r)
+		return NumberKind
+	case *additionExprNode:
+		l, r := c.kindOf(e.leftOperand), c.kindOf(e.rightOperand)
+		c.checkOperands(e, NumberKind|StringKind|TimeKind|DurationKind, l, r)
+		switch {
+		case l == TimeKind || r == TimeKind:
+			return TimeKind
+		case l == DurationKind || r == DurationKind:
+			return DurationKind
+		case l == NumberKind:
+			return NumberKind
+		case l == StringKind:
+			return StringKind
+		}
+		return AnyKind
+	case *subtractionExprNode:
+		l, r := c.kindOf(e.leftOperand), c.kindOf(e.rightOperand)
+		if l == TimeKind {
+			c.checkOperands(e, NumberKind|StringKind|TimeKind|DurationKind, r)
+		} else {
+			c.checkOperands(e, NumberKind|TimeKind|DurationKind, l, r)
+		}
+		switch {
+		case l == TimeKind && r == TimeKind:
+			return DurationKind
+		case l == TimeKind || l == DurationKind:
+			return l
+		case l != AnyKind:
+			return NumberKind
+		}
+		return AnyKind
+	case *ternaryExprNode:
+		c.kindOf(e.leftOperand)
+		return c.kindOf(e.rightOperand)
+	case *ternaryBranchesExprNode:
+		l, r := c.kindOf(e.leftOperand), c.kindOf(e.rightOperand)
+		if l == AnyKind || r == AnyKind {
+			return AnyKind
+		}
+		return l | r
+	}
+	c.childrenKinds(node)
+	return AnyKind
+}
+
+// childrenKinds checks the children of @node, and returns the kinds of the left and right operands.
+func (c *kindChecker) childrenKinds(node ExprNode) (l, r Kind) {
+	for _, child := range childrenOf(node) {
+		k := c.kindOf(child)
+		switch child {
+		case node.LeftOperand():
+			l = k
+		case node.RightOperand():
+			r = k
+		}
+	}
+	return
+}
+
+// selectorKind returns the kind of the selected field value.
+func (c *kindChecker) selectorKind(e *selectorExprNode) Kind {
+	for _, sub := range e.subExprs {
+		c.kindOf(sub)
+	}
+	if e.scoped() {
+		// the ancestor struct is unknown statically
+		if e.boolOpposite != nil {
+			return BoolKind
+		}
+		return AnyKind
+	}
+	field := e.field
+	if field == "" {
+		field = c.field
+	}
+	f := c.s.fields[field]
+	if f == nil {
+		c.report(posOf(e), DiagUnknownSelector, fmt.Sprintf("unknown field %q", field))
+	}
+	if e.boolOpposite != nil {
+		return BoolKind
+	}
+	if f == nil || f.elemType == nil {
+		return AnyKind
+	}
+	t := f.elemType
+	for _, sub := range e.subExprs {
+		t = derefType(t)
+		if s, ok := sub.(*subscriptExprNode); ok {
+			if s.wildcard {
+				return ListKind
+			}
+			// the slice has the same kind
+			continue
+		}
+		switch t.Kind() {
+		case reflect.Array, reflect.Slice, reflect.Map:
+			t = t.Elem()
+		case reflect.String:
+			return NumberKind
+		default:
+			return AnyKind
+		}
+	}
+	return kindOfType(t)
+}
+
+// funcKind checks the arguments of the function, and returns the kind of the result.
+func (c *kindChecker) funcKind(e *funcExprNode) Kind {
+	kinds := make([]Kind, len(e.args))
+	for i, arg := range e.args {
+		kinds[i] = c.kindOf(arg)
+	}
+	if c.err != nil {
+		return AnyKind
+	}
+	if e.sig != nil && countArgs(e.args) > 0 {
+		for i, k := range kinds {
+			if want := e.sig.argKind(i); !want.accepts(k) {
+				msg := fmt.Sprintf("%s() argument %d expects %s, got %s", e.name, i+1, want, k)
+				if e.sig.Loose {
+					c.report(posOf(e), DiagArgumentKind, msg)
+					continue
+				}
+				c.err = &SyntaxError{Expr: c.p.src, Offset: posOf(e), Msg: msg}
+				return AnyKind
+			}
+		}
+	}
+	if e.boolOpposite != nil {
+		return BoolKind
+	}
+	if e.sig != nil {
+		return e.sig.Out
+	}
+	return AnyKind
+}
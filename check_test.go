@@ -0,0 +1,96 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bytedance/go-tagexpr/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	type Sub struct {
+		N int    `te:"$>0"`
+		S string `te:"$*2"`
+	}
+	type T struct {
+		A    int               `te:"(Missing.Field)$ > 0 && len($) > 0"`
+		B    string            `te:"@:$; msg:len($)"`
+		C    []Sub             `te:"len($)>0 && $[0] + 1 > 0"`
+		D    map[string]*Sub   `te:"$"`
+		E    time.Time         `te:"a:$ - 1 > 0;b:$ - (F)$ > '1h';c:(E)$ < (F)$"`
+		F    time.Time         `te:"(Sub.N)$ > 0 || (G.N)$ > 0"`
+		G    Sub               `te:"(G.N)$ > 0 && (G.S)$ != '' && !$ && true & 1"`
+		H    map[string]string `te:"a:$['k'] + 1 > 0 ? 'ok' : 1;b:sprintf('%v', $)"`
+		Skip int               `te:"-"`
+	}
+	vm := tagexpr.New("te")
+	diags, err := vm.Check(reflect.TypeOf(T{}), map[string]tagexpr.Kind{
+		"@":   tagexpr.BoolKind,
+		"msg": tagexpr.StringKind,
+		"a":   tagexpr.BoolKind,
+	})
+	assert.NoError(t, err)
+	var got []string
+	for _, d := range diags {
+		got = append(got, string(d.Code)+": "+d.Field+"@"+d.ExprName+": "+d.Msg)
+	}
+	assert.Equal(t, []string{
+		`unknown-selector: A@@: unknown field "Missing.Field"`,
+		`argument-kind: A@@: len() argument 1 expects string|list|map, got number`,
+		`result-kind: B@@: expression expects bool result, got string`,
+		`result-kind: B@msg: expression expects string result, got number`,
+		`operand-kind: C@@: operator + expects number|string|time|duration, got struct`,
+		`result-kind: D@@: expression expects bool result, got map`,
+		`unknown-selector: F@@: unknown field "Sub.N"`,
+		`operand-kind: G@@: operator & expects number, got bool`,
+		`result-kind: H@a: expression expects bool result, got number|string`,
+		`operand-kind: S@@: operator * expects number|duration, got string`,
+		`result-kind: S@@: expression expects bool result, got number`,
+	}, got)
+	assert.Equal(t, "struct tagexpr_test.T, field A, tag te, expr @: unknown field \"Missing.Field\" at offset 0", diags[0].String())
+	assert.Equal(t, 17, diags[4].Offset)
+
+	// the checked struct can be run
+	_, err = vm.Run(&T{})
+	assert.NoError(t, err)
+
+	_, err = vm.Check(&struct {
+		A int `te:"lower($)"`
+	}{})
+	assert.EqualError(t, err, "syntax error: struct struct { A int \"te:\\\"lower($)\\\"\" }, field A, tag te, expr @: lower() argument 1 expects string, got number at offset 0\n\tlower($)\n\t^")
+	_, err = vm.Check(1)
+	assert.EqualError(t, err, "unsupport type: int")
+
+	// the slice has the kind of the sliced value, and [*] selects a list
+	diags, err = vm.Check(&struct {
+		A []int             `te:"a:$[1:] > 0;b:$[-1] > 0;c:len($[*]) > 0 && $[:2][0] > 0"`
+		B string            `te:"$[1:3] * 2 > 0"`
+		C []struct{ N int } `te:"$[*].N > 0"`
+	}{})
+	assert.NoError(t, err)
+	got = got[:0]
+	for _, d := range diags {
+		got = append(got, string(d.Code)+": "+d.Field+"@"+d.ExprName+": "+d.Msg)
+	}
+	assert.Equal(t, []string{
+		`operand-kind: A@a: operator > expects number|string|time|duration, got list`,
+		`operand-kind: B@@: operator * expects number|duration, got string`,
+		`operand-kind: C@@: operator > expects number|string|time|duration, got list`,
+	}, got)
+}
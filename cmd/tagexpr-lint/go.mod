@@ -0,0 +1,11 @@
+module github.com/bytedance/go-tagexpr/v2/cmd/tagexpr-lint
+
+go 1.14
+
+require (
+	github.com/bytedance/go-tagexpr/v2 v2.9.11
+	golang.org/x/tools v0.1.0
+)
+
+// the analyzer uses CheckTag and binding.Config.CheckField of the go-tagexpr in this repository
+replace github.com/bytedance/go-tagexpr/v2 => ../..
@@ -0,0 +1,34 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command tagexpr-lint reports the broken tagexpr and binding struct tags.
+//
+// Usage:
+//
+//	tagexpr-lint [-tags vd,tagexpr] [-funcs name1,name2] [-binding=true] packages...
+//
+// It can also be used as a vet tool:
+//
+//	go vet -vettool=$(which tagexpr-lint) ./...
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/bytedance/go-tagexpr/v2/cmd/tagexpr-lint/tagexprlint"
+)
+
+func main() {
+	singlechecker.Main(tagexprlint.Analyzer)
+}
@@ -0,0 +1,217 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tagexprlint defines an analyzer that reports the broken tagexpr and binding struct tags.
+package tagexprlint
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+
+	"github.com/bytedance/go-tagexpr/v2"
+	"github.com/bytedance/go-tagexpr/v2/binding"
+	// register the validator functions, such as email and phone
+	_ "github.com/bytedance/go-tagexpr/v2/validator"
+)
+
+const doc = `report the broken tagexpr and binding struct tags
+
+The tagexpr tags (vd and tagexpr by default) are parsed as the VM does,
+reporting syntax errors, duplicate expression names, unknown functions
+and wrong numbers of function arguments.
+The binding tags (path, query, header, cookie, form, json, raw_body, default)
+are checked for the conflicting and unsupported combinations.`
+
+// Analyzer reports the broken tagexpr and binding struct tags.
+var Analyzer = &analysis.Analyzer{
+	Name:     "tagexprlint",
+	Doc:      doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+var (
+	// tagNames the tag names of the tagexpr expressions, separated by ','
+	tagNames = "vd,tagexpr"
+	// funcNames the custom function names registered by the checked program, separated by ','
+	funcNames string
+	// checkBinding whether to check the binding tags
+	checkBinding = true
+
+	regFuncsOnce sync.Once
+)
+
+func init() {
+	Analyzer.Flags.StringVar(&tagNames, "tags", tagNames, "comma-separated tag names of the tagexpr expressions")
+	Analyzer.Flags.StringVar(&funcNames, "funcs", funcNames, "comma-separated names of the custom functions registered by the program")
+	Analyzer.Flags.BoolVar(&checkBinding, "binding", checkBinding, "check the binding tags")
+}
+
+// regFuncs registers the custom functions, so that they are not reported as unknown.
+func regFuncs() {
+	for _, name := range splitList(funcNames) {
+		// ignore the error of the function already registered
+		_ = tagexpr.RegFunc(name, func(...interface{}) interface{} { return nil })
+	}
+}
+
+func splitList(s string) []string {
+	var a []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			a = append(a, v)
+		}
+	}
+	return a
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	regFuncsOnce.Do(regFuncs)
+	names := splitList(tagNames)
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	inspect.Preorder([]ast.Node{(*ast.StructType)(nil)}, func(n ast.Node) {
+		for _, field := range n.(*ast.StructType).Fields.List {
+			if field.Tag == nil {
+				continue
+			}
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				continue
+			}
+			checkField(pass, field, reflect.StructTag(tag), names)
+		}
+	})
+	return nil, nil
+}
+
+func checkField(pass *analysis.Pass, field *ast.Field, tag reflect.StructTag, names []string) {
+	for _, name := range names {
+		value, ok := tag.Lookup(name)
+		if !ok {
+			continue
+		}
+		err := tagexpr.CheckTag(value)
+		if err == nil {
+			continue
+		}
+		if e, ok := err.(*tagexpr.SyntaxError); ok {
+			e.Tag = name
+		}
+		// the first line without the excerpt
+		msg := strings.SplitN(err.Error(), "\n", 2)[0]
+		pass.Reportf(field.Tag.Pos(), "%s: %q", msg, value)
+	}
+	if !checkBinding {
+		return
+	}
+	typ := reflectTypeOf(pass.TypesInfo.TypeOf(field.Type))
+	for _, fieldName := range fieldNames(field) {
+		sf := reflect.StructField{Name: fieldName, Tag: tag, Type: typ}
+		for _, err := range new(binding.Config).CheckField(sf) {
+			pass.Reportf(field.Tag.Pos(), "binding: %v", err)
+		}
+	}
+}
+
+// fieldNames returns the names of the field, or the type name of the embedded field.
+func fieldNames(field *ast.Field) []string {
+	if len(field.Names) > 0 {
+		a := make([]string, len(field.Names))
+		for i, ident := range field.Names {
+			a[i] = ident.Name
+		}
+		return a
+	}
+	t := field.Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	switch x := t.(type) {
+	case *ast.Ident:
+		return []string{x.Name}
+	case *ast.SelectorExpr:
+		return []string{x.Sel.Name}
+	}
+	return nil
+}
+
+var (
+	interfaceType   = reflect.TypeOf((*interface{})(nil)).Elem()
+	jsonUnmarshaler = types.NewInterfaceType([]*types.Func{
+		types.NewFunc(0, nil, "UnmarshalJSON", types.NewSignature(nil,
+			types.NewTuple(types.NewVar(0, nil, "", types.NewSlice(types.Typ[types.Byte]))),
+			types.NewTuple(types.NewVar(0, nil, "", types.Universe.Lookup("error").Type())), false)),
+	}, nil).Complete()
+)
+
+// reflectTypeOf returns the reflect.Type with the same shape as @t,
+// or nil if it is opaque to binding, e.g. the struct or the type with UnmarshalJSON method.
+func reflectTypeOf(t types.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	if types.Implements(t, jsonUnmarshaler) || types.Implements(types.NewPointer(t), jsonUnmarshaler) {
+		return nil
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return basicTypes[u.Kind()]
+	case *types.Pointer:
+		if elem := reflectTypeOf(u.Elem()); elem != nil {
+			return reflect.PtrTo(elem)
+		}
+	case *types.Slice:
+		if elem := reflectTypeOf(u.Elem()); elem != nil {
+			return reflect.SliceOf(elem)
+		}
+	case *types.Array:
+		if elem := reflectTypeOf(u.Elem()); elem != nil {
+			return reflect.ArrayOf(int(u.Len()), elem)
+		}
+	case *types.Map:
+		key, elem := reflectTypeOf(u.Key()), reflectTypeOf(u.Elem())
+		if key != nil && elem != nil && key.Comparable() {
+			return reflect.MapOf(key, elem)
+		}
+	case *types.Interface:
+		return interfaceType
+	}
+	return nil
+}
+
+var basicTypes = map[types.BasicKind]reflect.Type{
+	types.Bool:    reflect.TypeOf(false),
+	types.Int:     reflect.TypeOf(int(0)),
+	types.Int8:    reflect.TypeOf(int8(0)),
+	types.Int16:   reflect.TypeOf(int16(0)),
+	types.Int32:   reflect.TypeOf(int32(0)),
+	types.Int64:   reflect.TypeOf(int64(0)),
+	types.Uint:    reflect.TypeOf(uint(0)),
+	types.Uint8:   reflect.TypeOf(uint8(0)),
+	types.Uint16:  reflect.TypeOf(uint16(0)),
+	types.Uint32:  reflect.TypeOf(uint32(0)),
+	types.Uint64:  reflect.TypeOf(uint64(0)),
+	types.Uintptr: reflect.TypeOf(uintptr(0)),
+	types.Float32: reflect.TypeOf(float32(0)),
+	types.Float64: reflect.TypeOf(float64(0)),
+	types.String:  reflect.TypeOf(""),
+}
@@ -0,0 +1,12 @@
+package tagexprlint
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	funcNames = "myFunc"
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "a")
+}
@@ -0,0 +1,21 @@
+package a
+
+type Duration int64
+
+func (d *Duration) UnmarshalJSON(b []byte) error { return nil }
+
+type T struct {
+	A int      `vd:"$>0"`
+	B string   `vd:"len($)>"`     // want `syntax error: tag vd, expr @: .*`
+	C string   `tagexpr:"$;@:$"`  // want `syntax error: tag tagexpr: .*`
+	D string   `vd:"unknown($)"`  // want `syntax error: tag vd, expr @: .*unknown.*`
+	E string   `vd:"lower($, 1)"` // want `syntax error: tag vd, expr @: .*lower\(\) expects 1 argument, got 2.*`
+	F string   `vd:"myFunc($)"`   // registered by -funcs
+	G string   `vd:"email($)" query:"g,required"`
+	H string   `query:"-,required"`      // want `binding: query:"-,required" omits the field, which can not be required`
+	I int      `raw_body:""`             // want `binding: raw_body can not bind to the int field, only \[\]byte and string are supported`
+	J string   `raw_body:"" default:"x"` // want `binding: default is never used, since raw_body binds the field even if the body is empty`
+	K int      `query:"k" default:"abc"` // want `binding: default:"abc" is invalid: .*`
+	L Duration `query:"l" default:"1s"`
+	M *int     `query:"m" default:"1"`
+}
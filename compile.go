@@ -0,0 +1,369 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"context"
+	"sync"
+)
+
+// --------------------------- Compiler ---------------------------
+
+// evalFunc the compiled expression node.
+type evalFunc func(st *evalState) interface{}
+
+// evalState the state of one evaluation of the compiled expression,
+// which replaces the context values used by ExprNode.Run.
+type evalState struct {
+	ctx     context.Context
+	field   string
+	tagExpr *TagExpr
+	env     map[string]interface{}
+	locals  []localValue // the values of the let-bindings in scope
+	elem    rangeElem    // the current range element
+	inRange bool
+}
+
+// evalStatePool the states of the evaluations in progress;
+// the state passed to the closures escapes, so it is pooled instead of allocated on every evaluation.
+var evalStatePool = sync.Pool{New: func() interface{} { return new(evalState) }}
+
+// eval calls the compiled expression with the pooled state.
+func (fn evalFunc) eval(ctx context.Context, field string, tagExpr *TagExpr, env map[string]interface{}) interface{} {
+	st := evalStatePool.Get().(*evalState)
+	*st = evalState{ctx: ctx, field: field, tagExpr: tagExpr, env: env}
+	r := fn(st)
+	*st = evalState{}
+	evalStatePool.Put(st)
+	return r
+}
+
+// localValue the value of the let-binding.
+type localValue struct {
+	binding *letExprNode
+	val     interface{}
+}
+
+// local returns the value of the let-binding @le in scope.
+func (st *evalState) local(le *letExprNode) interface{} {
+	for i := len(st.locals) - 1; i >= 0; i-- {
+		if st.locals[i].binding == le {
+			return st.locals[i].val
+		}
+	}
+	return nil
+}
+
+// context returns the context carrying the env, the local variables and the range element,
+// only for the node that can not be compiled.
+func (st *evalState) context() context.Context {
+	ctx := st.ctx
+	if st.env != nil {
+		ctx = context.WithValue(ctx, variableKey, st.env)
+	}
+	for _, l := range st.locals {
+		ctx = context.WithValue(ctx, l.binding, l.val)
+	}
+	if st.inRange {
+		ctx = st.elem.context(ctx)
+	}
+	return ctx
+}
+
+// rangeEval returns the evaluator of the element expression @fn for the range functions.
+// NOTE:
+//
+//	It is inlined and the evaluator does not escape the range functions,
+//	so the closure is not allocated.
+func (st *evalState) rangeEval(fn evalFunc) func(rangeElem) interface{} {
+	return func(el rangeElem) interface{} {
+		elem, inRange := st.elem, st.inRange
+		st.elem, st.inRange = el, true
+		r := fn(st)
+		st.elem, st.inRange = elem, inRange
+		return r
+	}
+}
+
+// compiledNode the compiled expression node, which is a constant if isConst.
+type compiledNode struct {
+	fn      evalFunc
+	isConst bool
+	val     interface{}
+}
+
+func constNode(v interface{}) compiledNode {
+	return compiledNode{
+		fn:      func(*evalState) interface{} { return v },
+		isConst: true,
+		val:     v,
+	}
+}
+
+// compiler compiles the expression tree into the closures.
+// NOTE:
+//
+//	If @s is not nil, the field selectors are resolved to the fields of the struct,
+//	and @field is the name of the field that the expression belongs to.
+//
+//	If @trace is not nil, the value of every node is recorded, see explain.
+type compiler struct {
+	s     *structVM
+	field string
+	trace *explainTrace
+}
+
+// compile compiles the expression into the closures, which are used by run.
+// NOTE:
+//
+//	It must be called before the expression is shared by goroutines.
+func (p *Expr) compile(s *structVM, field string) {
+	c := &compiler{s: s, field: field}
+	p.fn = c.compile(p.expr).fn
+}
+
+func (c *compiler) compile(node ExprNode) compiledNode {
+	x := c.compileNode(node)
+	if c.trace == nil || node == nil {
+		return x
+	}
+	// the traced node is not folded, so that its value is recorded when it is evaluated
+	fn, values := x.fn, c.trace.values
+	return compiledNode{fn: func(st *evalState) interface{} {
+		r := fn(st)
+		values[node] = r
+		return r
+	}}
+}
+
+func (c *compiler) compileNode(node ExprNode) compiledNode {
+	switch e := node.(type) {
+	case nil:
+		return constNode(nil)
+	case *boolExprNode:
+		return constNode(e.val)
+	case *stringExprNode:
+		return constNode(e.val)
+	case *digitalExprNode:
+		return constNode(e.val)
+	case *nilExprNode:
+		return constNode(e.val)
+	case *constExprNode:
+		return constNode(e.val)
+	case *groupExprNode:
+		return c.compileGroup(e)
+	case *variableExprNode:
+		if e.local != nil {
+			return compiledNode{fn: func(st *evalState) interface{} {
+				return realValue(st.local(e.local), e.boolOpposite, nil)
+			}}
+		}
+		return compiledNode{fn: func(st *evalState) interface{} {
+			return e.lookup(st.env)
+		}}
+	case *letExprNode:
+		val, body := c.compile(e.leftOperand).fn, c.compile(e.rightOperand).fn
+		return compiledNode{fn: func(st *evalState) interface{} {
+			n := len(st.locals)
+			st.locals = append(st.locals, localValue{binding: e, val: val(st)})
+			r := body(st)
+			st.locals = st.locals[:n]
+			return r
+		}}
+	case *selectorExprNode:
+		return c.compileSelector(e)
+	case *subscriptExprNode:
+		if e.wildcard {
+			return constNode(wildcardSub{})
+		}
+		lo, hi := c.compile(e.LeftOperand()).fn, c.compile(e.RightOperand()).fn
+		return compiledNode{fn: func(st *evalState) interface{} {
+			return sliceSub{lo: lo(st), hi: hi(st)}
+		}}
+	case *rangeKvExprNode:
+		return c.compileRangeKv(e)
+	case *funcExprNode:
+		return c.compileFunc(e)
+	case *regexpFuncExprNode:
+		arg := c.compile(e.RightOperand()).fn
+		return compiledNode{fn: func(st *evalState) interface{} {
+			return e.match(arg(st))
+		}}
+	case *sprintfFuncExprNode:
+		args := c.compileAll(e.args)
+		return compiledNode{fn: func(st *evalState) interface{} {
+			return e.sprintf(evalAll(st, args))
+		}}
+	case *rangeFuncExprNode:
+		obj, elem := c.compile(e.object).fn, c.compile(e.elemExprNode).fn
+		return compiledNode{fn: func(st *evalState) interface{} {
+			return e.rangeValues(obj(st), st.rangeEval(elem))
+		}}
+	case *collectionFuncExprNode:
+		obj, elem := c.compile(e.object).fn, c.compile(e.elemExprNode).fn
+		return compiledNode{fn: func(st *evalState) interface{} {
+			return e.collect(obj(st), st.rangeEval(elem))
+		}}
+	case *andExprNode:
+		return c.compileLogic(e, false)
+	case *orExprNode:
+		return c.compileLogic(e, true)
+	case *ternaryExprNode:
+		return c.compileTernary(e)
+	case binaryOperator:
+		return c.compileOperator(e)
+	}
+	// the node unknown to the compiler
+	return compiledNode{fn: func(st *evalState) interface{} {
+		return node.Run(st.context(), st.field, st.tagExpr)
+	}}
+}
+
+func (c *compiler) compileAll(nodes []ExprNode) []evalFunc {
+	a := make([]evalFunc, len(nodes))
+	for i, node := range nodes {
+		a[i] = c.compile(node).fn
+	}
+	return a
+}
+
+func evalAll(st *evalState, fns []evalFunc) []interface{} {
+	if len(fns) == 0 {
+		return nil
+	}
+	a := make([]interface{}, len(fns))
+	for i, fn := range fns {
+		a[i] = fn(st)
+	}
+	return a
+}
+
+func (c *compiler) compileGroup(e *groupExprNode) compiledNode {
+	if e.RightOperand() == nil {
+		return constNode(nil)
+	}
+	x := c.compile(e.RightOperand())
+	boolOpposite, signOpposite := e.boolOpposite, e.signOpposite
+	if x.isConst {
+		return constNode(realValue(x.val, boolOpposite, signOpposite))
+	}
+	fn := x.fn
+	return compiledNode{fn: func(st *evalState) interface{} {
+		return realValue(fn(st), boolOpposite, signOpposite)
+	}}
+}
+
+func (c *compiler) compileOperator(e binaryOperator) compiledNode {
+	l, r := c.compile(e.LeftOperand()), c.compile(e.RightOperand())
+	if l.isConst && r.isConst {
+		return constNode(e.operate(l.val, r.val))
+	}
+	lfn, rfn := l.fn, r.fn
+	return compiledNode{fn: func(st *evalState) interface{} {
+		return e.operate(lfn(st), rfn(st))
+	}}
+}
+
+// compileLogic compiles && (@or=false) or || (@or=true).
+func (c *compiler) compileLogic(e ExprNode, or bool) compiledNode {
+	l, r := c.compile(e.LeftOperand()), c.compile(e.RightOperand())
+	if l.isConst && r.isConst {
+		return constNode(logicResult(l.val, or, func() interface{} { return r.val }))
+	}
+	lfn, rfn := l.fn, r.fn
+	return compiledNode{fn: func(st *evalState) interface{} {
+		return logicResult(lfn(st), or, func() interface{} { return rfn(st) })
+	}}
+}
+
+func (c *compiler) compileTernary(e *ternaryExprNode) compiledNode {
+	cond := c.compile(e.LeftOperand())
+	x, y := c.compile(e.RightOperand().LeftOperand()), c.compile(e.RightOperand().RightOperand())
+	if cond.isConst {
+		if err := numberErrorOf(cond.val); err != nil {
+			return constNode(err)
+		}
+		if FakeBool(cond.val) {
+			return x
+		}
+		return y
+	}
+	cfn, xfn, yfn := cond.fn, x.fn, y.fn
+	return compiledNode{fn: func(st *evalState) interface{} {
+		cond := cfn(st)
+		if err := numberErrorOf(cond); err != nil {
+			return err
+		}
+		if FakeBool(cond) {
+			return xfn(st)
+		}
+		return yfn(st)
+	}}
+}
+
+func (c *compiler) compileFunc(e *funcExprNode) compiledNode {
+	if e.set != nil {
+		// in() with the hashed constant set
+		elem := c.compile(e.args[0]).fn
+		return compiledNode{fn: func(st *evalState) interface{} {
+			return realValue(e.set.contains(elem(st)), e.boolOpposite, e.signOpposite)
+		}}
+	}
+	args := c.compileAll(e.args)
+	return compiledNode{fn: func(st *evalState) interface{} {
+		return e.call(st.ctx, evalAll(st, args))
+	}}
+}
+
+func (c *compiler) compileRangeKv(e *rangeKvExprNode) compiledNode {
+	key := e.ctxKey
+	return compiledNode{fn: func(st *evalState) interface{} {
+		var val interface{}
+		if st.inRange {
+			switch key {
+			case rangeKey:
+				val = st.elem.k
+			case rangeValue:
+				val = st.elem.v
+			case rangeLen:
+				val = st.elem.n
+			}
+		}
+		return e.value(val)
+	}}
+}
+
+// compileSelector compiles the field selector,
+// and resolves the field of the struct in advance.
+func (c *compiler) compileSelector(e *selectorExprNode) compiledNode {
+	subs := c.compileAll(e.subExprs)
+	var f *fieldVM
+	if c.s != nil && !e.scoped() {
+		name := e.field
+		if name == "" {
+			name = c.field
+		}
+		f = c.s.fields[name]
+	}
+	s, field := c.s, c.field
+	return compiledNode{fn: func(st *evalState) interface{} {
+		subFields := evalAll(st, subs)
+		t := st.tagExpr
+		if f != nil && t.s == s && (e.field != "" || st.field == field) {
+			return realValue(t.getFieldValue(f, subFields), e.boolOpposite, e.signOpposite)
+		}
+		return e.value(st.field, t, subFields)
+	}}
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type compileSub struct {
+	N int               `te:"$>0"`
+	M map[string]string `te:"len($)==1 && (N)$>1 ? 'x' : #v"`
+}
+
+type compileT struct {
+	A int          `te:"$>(B)$ && len((C)$)<3;b:$-(B)$*2;c:!!$;d:-$"`
+	B float64      `te:"(A)$>0 ? $/2 : max($, 1)"`
+	C string       `te:"regexp('^a') && sprintf('%s-%v', $, (A)$)=='ab-5';b:$[0]+$[1]"`
+	D []int        `te:"range($, #v*#k+##);b:count($, #v>1);c:filter($, #v>1);d:unique($);e:all($, #v>0)"`
+	E []compileSub `te:"map($, #v.N*2);b:any($, #v.M.x=='y');c:len($)"`
+	F compileSub
+	G *compileSub `te:"?"`
+	H string      `te:"1+2*3>5 && 'a'+'b'=='ab';b:0 ? 1 : 2;c:false && $;d:x"`
+}
+
+func TestCompile(t *testing.T) {
+	vm := New("te")
+	te := vm.MustRun(&compileT{
+		A: 5,
+		B: 1.5,
+		C: "ab",
+		D: []int{1, 2, 2},
+		E: []compileSub{{N: 1}, {N: 2, M: map[string]string{"x": "y"}}},
+		F: compileSub{N: 3, M: map[string]string{"k": "v"}},
+	})
+	var n int
+	err := te.Range(func(eh *ExprHandler) error {
+		expr := eh.expr.s.exprs[eh.selector]
+		assert.NotNil(t, expr.fn, eh.Path())
+		tree := normalizeNumber(expr.expr.Run(context.Background(), eh.base, eh.targetExpr))
+		assert.Equal(t, tree, eh.Eval(), eh.Path())
+		n++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 25, n)
+	assert.Equal(t, []interface{}{3.0, 5.0, 7.0}, te.Eval("D"))
+	assert.Equal(t, "x", te.Eval("F.M"))
+
+	// the env variable
+	p := MustCompile("x+(A)$")
+	r, err := p.EvalWithEnv(map[string]interface{}{"A": 1}, map[string]interface{}{"x": 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), r)
+
+	// constant folding
+	for _, src := range []string{"1+2*3>5 && 'a'+'b'=='ab'", "0 ? x : 2", "false && x", "!(1-1)"} {
+		c := &compiler{}
+		assert.True(t, c.compile(MustCompile(src).expr.expr).isConst, src)
+	}
+	for _, src := range []string{"x+1", "true && x", "now()"} {
+		c := &compiler{}
+		assert.False(t, c.compile(MustCompile(src).expr.expr).isConst, src)
+	}
+}
+
+// benchmarkEval evaluates A and B with the compiled closures or the expression tree.
+// NOTE:
+//
+//	The compiled evaluation allocates about 11 times per op, none for the evaluation state:
+//	the elements of (C)$ boxed by count (about 5), the string field (B)$ boxed for len and regexp (2),
+//	the arguments of len (1) and the boxed result of len.
+func benchmarkEval(b *testing.B, compiled bool) {
+	type T struct {
+		A int    `bench:"$>0 && len((B)$)<10 && count((C)$, #v>1)>0"`
+		B string `bench:"regexp('^\\w+$') && (A)$*2+1>3"`
+		C []int
+	}
+	vm := New("bench")
+	te := vm.MustRun(&T{A: 10, B: "abc", C: []int{1, 2, 3}})
+	if !compiled {
+		fns := make(map[*Expr]evalFunc, len(te.s.exprs))
+		for _, expr := range te.s.exprs {
+			fns[expr], expr.fn = expr.fn, nil
+		}
+		defer func() {
+			for expr, fn := range fns {
+				expr.fn = fn
+			}
+		}()
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !te.EvalBool("A") || !te.EvalBool("B") {
+			b.FailNow()
+		}
+	}
+}
+
+func BenchmarkEvalTree(b *testing.B) {
+	benchmarkEval(b, false)
+}
+
+func BenchmarkEvalCompiled(b *testing.B) {
+	benchmarkEval(b, true)
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/andeya/ameda"
+	"github.com/andeya/goutil/errors"
+)
+
+// --------------------------- Env ---------------------------
+
+// EnvVar the declaration of the env variable, e.g. minVal in $>=minVal.
+type EnvVar struct {
+	// Kind the kinds of the value, AnyKind accepts all values
+	Kind Kind
+	// Required the variable must be passed by the env, unless it has a Default
+	Required bool
+	// Default the value if the variable is not passed or nil
+	Default interface{}
+}
+
+// MustDeclareEnv declares the env variable for the struct tags of the VM.
+// NOTE:
+//
+//	The same as DeclareEnv, but panic if there is an error.
+func (vm *VM) MustDeclareEnv(name string, v EnvVar) {
+	err := vm.DeclareEnv(name, v)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// DeclareEnv declares the env variable for the struct tags of the VM.
+// NOTE:
+//
+//	Once a variable is declared, the undeclared variables are rejected when the struct tag is parsed,
+//	so the variables must be declared before the structs are registered,
+//	otherwise an error is returned since the registered structs are not checked;
+//	The Default is converted to the Kind, and used even if the expression is evaluated without env;
+//	The env values are checked and converted by WithEnv and TagExpr.EvalWithEnv.
+func (vm *VM) DeclareEnv(name string, v EnvVar) error {
+	if name == "" || variableRegex.FindString(name) != name {
+		return errors.Errorf("invalid env variable name: %q", name)
+	}
+	if v.Default != nil {
+		d, err := convertEnvValue(name, v.Default, v.Kind)
+		if err != nil {
+			return err
+		}
+		v.Default = d
+	}
+	vm.rw.Lock()
+	defer vm.rw.Unlock()
+	if len(vm.structJar) > 0 {
+		return errors.Errorf("env variable %q must be declared before the structs are registered", name)
+	}
+	if vm.env == nil {
+		vm.env = make(map[string]EnvVar)
+	}
+	if _, ok := vm.env[name]; !ok {
+		vm.envNames = append(vm.envNames, name)
+		sort.Strings(vm.envNames)
+	}
+	vm.env[name] = v
+	return nil
+}
+
+// WithEnv returns the context carrying @env, which is used by the expressions evaluated with the context,
+// e.g. TagExpr.EvalContext, ExprHandler.EvalContext and ExprHandler.ExplainContext.
+// NOTE:
+//
+//	The declared variables are checked and converted to the internal types,
+//	e.g. int to int64 and '10' to 10 for NumberKind;
+//	Return error if a required variable is missing or has the wrong kind.
+func (vm *VM) WithEnv(ctx context.Context, env map[string]interface{}) (context.Context, error) {
+	env, err := vm.convertEnv(env)
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, variableKey, env), nil
+}
+
+// convertEnv returns the copy of @env whose declared variables are checked and converted.
+func (vm *VM) convertEnv(env map[string]interface{}) (map[string]interface{}, error) {
+	vm.rw.RLock()
+	defer vm.rw.RUnlock()
+	if len(vm.env) == 0 {
+		return env, nil
+	}
+	r := make(map[string]interface{}, len(env)+len(vm.env))
+	for k, v := range env {
+		r[k] = v
+	}
+	for _, name := range vm.envNames {
+		decl := vm.env[name]
+		v := env[name]
+		if v == nil {
+			if decl.Default != nil {
+				r[name] = decl.Default
+			} else if decl.Required {
+				return nil, errors.Errorf("missing env variable: %q", name)
+			}
+			continue
+		}
+		v, err := convertEnvValue(name, v, decl.Kind)
+		if err != nil {
+			return nil, err
+		}
+		r[name] = v
+	}
+	return r, nil
+}
+
+// convertEnvValue converts the value of the env variable @name to the internal type of @kind,
+// and parses the string for the number, bool, time and duration, e.g. from the config.
+func convertEnvValue(name string, v interface{}, kind Kind) (interface{}, error) {
+	k := kindOfValue(v)
+	if kind.accepts(k) {
+		switch k {
+		case NumberKind:
+			if n, ok := toNumber(v, false); ok {
+				return n, nil
+			}
+		case StringKind:
+			if s, ok := toString(v, false); ok {
+				return s, nil
+			}
+		case BoolKind:
+			if rv := ameda.DereferenceValue(reflect.ValueOf(v)); rv.Kind() == reflect.Bool {
+				return rv.Bool(), nil
+			}
+		case TimeKind:
+			if t, ok := toTime(v); ok {
+				return t, nil
+			}
+		case DurationKind:
+			if d, ok := toDuration(v); ok {
+				return d, nil
+			}
+		}
+		return v, nil
+	}
+	if s, ok := toString(v, false); ok {
+		if kind&NumberKind != 0 {
+			if n, ok := parseNumber(s); ok {
+				return n, nil
+			}
+		}
+		if kind&BoolKind != 0 {
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b, nil
+			}
+		}
+		if kind&DurationKind != 0 {
+			if d, err := time.ParseDuration(s); err == nil {
+				return d, nil
+			}
+		}
+		if kind&TimeKind != 0 {
+			if t, ok := parseTime(s); ok {
+				return t, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("env variable %q expects %s, got %s", name, kind, k)
+}
+
+// resolveEnv checks the variables of the expression against the declarations,
+// and sets their default values.
+// NOTE:
+//
+//	It is called with vm.rw locked.
+func (vm *VM) resolveEnv(p *Expr) error {
+	if len(vm.env) == 0 {
+		return nil
+	}
+	var err error
+	Inspect(p.expr, func(node ExprNode) bool {
+		e, ok := node.(*variableExprNode)
+		if !ok || err != nil || e.local != nil {
+			return err == nil
+		}
+		decl, ok := vm.env[e.val]
+		if !ok {
+			err = &SyntaxError{Expr: p.src, Offset: posOf(e), Msg: fmt.Sprintf("undeclared variable %q", e.val)}
+			return false
+		}
+		e.def = decl.Default
+		return true
+	})
+	return err
+}
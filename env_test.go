@@ -0,0 +1,96 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bytedance/go-tagexpr/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeclareEnv(t *testing.T) {
+	vm := tagexpr.New("te")
+	vm.MustDeclareEnv("minVal", tagexpr.EnvVar{Kind: tagexpr.NumberKind, Required: true})
+	vm.MustDeclareEnv("unit", tagexpr.EnvVar{Kind: tagexpr.StringKind, Default: "cm"})
+	vm.MustDeclareEnv("ttl", tagexpr.EnvVar{Kind: tagexpr.DurationKind})
+	assert.EqualError(t, vm.DeclareEnv("1x", tagexpr.EnvVar{}), `invalid env variable name: "1x"`)
+	assert.EqualError(t, vm.DeclareEnv("x", tagexpr.EnvVar{Kind: tagexpr.NumberKind, Default: "a"}), `env variable "x" expects number, got string`)
+
+	type T struct {
+		A int    `te:"$>=minVal"`
+		B string `te:"$+unit"`
+		C int64  `te:"ttl"`
+	}
+	te := vm.MustRun(&T{A: 10, B: "5"})
+	// the registered structs are not checked against the later declarations
+	assert.EqualError(t, vm.DeclareEnv("maxVal", tagexpr.EnvVar{}), `env variable "maxVal" must be declared before the structs are registered`)
+	assert.Equal(t, true, te.EvalWithEnv("A", map[string]interface{}{"minVal": 9}))
+	assert.Equal(t, false, te.EvalWithEnv("A", map[string]interface{}{"minVal": uint8(11)}))
+	// the string from the config
+	assert.Equal(t, true, te.EvalWithEnv("A", map[string]interface{}{"minVal": "10"}))
+	assert.EqualError(t, te.EvalWithEnv("A", nil).(error), `missing env variable: "minVal"`)
+	assert.EqualError(t, te.EvalWithEnv("A", map[string]interface{}{"minVal": true}).(error), `env variable "minVal" expects number, got bool`)
+	// the default value
+	assert.Equal(t, "5cm", te.Eval("B"))
+	assert.Equal(t, "5mm", te.EvalWithEnv("B", map[string]interface{}{"minVal": 0, "unit": "mm"}))
+	assert.Equal(t, time.Second, te.EvalWithEnv("C", map[string]interface{}{"minVal": 0, "ttl": "1s"}))
+
+	// the env carried by the context
+	_, err := vm.WithEnv(context.Background(), map[string]interface{}{"ttl": 1})
+	assert.EqualError(t, err, `missing env variable: "minVal"`)
+	ctx, err := vm.WithEnv(context.Background(), map[string]interface{}{"minVal": 20.5})
+	assert.NoError(t, err)
+	assert.Equal(t, false, te.EvalContext(ctx, "A"))
+	e := te.ExplainContext(ctx, "A")
+	assert.Equal(t, 20.5, e.Children[1].Value)
+
+	// the undeclared variable
+	type U struct {
+		A int `te:"$>=minval"`
+	}
+	_, err = vm.Run(&U{})
+	assert.EqualError(t, err, "syntax error: struct tagexpr_test.U, field A, tag te, expr @: undeclared variable \"minval\" at offset 3\n\t$>=minval\n\t   ^")
+
+	// the declared kind is checked statically
+	type V struct {
+		A int `te:"$*unit>0"`
+	}
+	diags, err := vm.Check(&V{})
+	assert.NoError(t, err)
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, "operator * expects number|duration, got string", diags[0].Msg)
+	}
+}
+
+func TestDeclareEnvConcurrently(t *testing.T) {
+	type T struct {
+		A int `te:"$>0"`
+	}
+	vm := tagexpr.New("te")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = vm.DeclareEnv("v", tagexpr.EnvVar{Kind: tagexpr.NumberKind})
+			_, _ = vm.WithEnv(context.Background(), map[string]interface{}{"v": i})
+		}
+	}()
+	_, err := vm.Run(&T{A: 1})
+	<-done
+	assert.NoError(t, err)
+}
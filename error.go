@@ -0,0 +1,86 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SyntaxError the error of parsing a struct tag or an expression
+type SyntaxError struct {
+	// Struct the struct type name, empty if not from a struct tag
+	Struct string
+	// Field the struct field name, empty if not from a struct tag
+	Field string
+	// Tag the struct tag name, empty if not from a struct tag
+	Tag string
+	// ExprName the expression name, empty if the whole tag is broken
+	ExprName string
+	// Expr the source expression, or the whole tag if ExprName is empty
+	Expr string
+	// Offset the byte offset of the error in Expr
+	Offset int
+	// Expected the expected token, such as operand, operator, ')'
+	Expected string
+	// Msg the error description, used when Expected is empty
+	Msg string
+}
+
+// Excerpt returns Expr with a caret pointing at Offset on the next line.
+func (e *SyntaxError) Excerpt() string {
+	offset := e.Offset
+	if offset < 0 {
+		offset = 0
+	} else if offset > len(e.Expr) {
+		offset = len(e.Expr)
+	}
+	return e.Expr + "\n" + strings.Repeat(" ", utf8.RuneCountInString(e.Expr[:offset])) + "^"
+}
+
+// Error implements error interface.
+func (e *SyntaxError) Error() string {
+	var loc []string
+	if e.Struct != "" {
+		loc = append(loc, "struct "+e.Struct)
+	}
+	if e.Field != "" {
+		loc = append(loc, "field "+e.Field)
+	}
+	if e.Tag != "" {
+		loc = append(loc, "tag "+e.Tag)
+	}
+	if e.ExprName != "" {
+		loc = append(loc, "expr "+e.ExprName)
+	}
+	var b strings.Builder
+	b.WriteString("syntax error: ")
+	if len(loc) > 0 {
+		b.WriteString(strings.Join(loc, ", "))
+		b.WriteString(": ")
+	}
+	if e.Expected != "" {
+		b.WriteString("expected ")
+		b.WriteString(e.Expected)
+	} else {
+		b.WriteString(e.Msg)
+	}
+	b.WriteString(" at offset ")
+	b.WriteString(strconv.Itoa(e.Offset))
+	b.WriteString("\n\t")
+	b.WriteString(strings.Replace(e.Excerpt(), "\n", "\n\t", 1))
+	return b.String()
+}
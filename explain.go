@@ -0,0 +1,138 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Explanation the evaluated expression tree,
+// which records the value of every sub-expression.
+type Explanation struct {
+	// Expr the source text of the sub-expression, e.g. len((C)$)<3
+	Expr string
+	// Node the textual form of the node, i.e. ExprNode.String(), e.g. <
+	Node string
+	// Offset the byte offset of Expr in the source expression
+	Offset int
+	// Value the result of the sub-expression;
+	// if it is evaluated more than once, e.g. in range, it is the last result
+	Value interface{}
+	// Evaluated false if the sub-expression is skipped, e.g. the right operand of false&&x
+	Evaluated bool
+	// Children the operands and the arguments
+	Children []*Explanation
+}
+
+// String returns the explanation tree, one sub-expression with its value per line.
+func (e *Explanation) String() string {
+	return string(e.format(0, true))
+}
+
+func (e *Explanation) format(level int, tail bool) []byte {
+	var b bytes.Buffer
+	above := len(e.Children) / 2
+	for _, child := range e.Children[:above] {
+		b.Write(child.format(level+1, false))
+	}
+	label := e.Expr + " => "
+	if e.Evaluated {
+		label += formatValue(e.Value)
+	} else {
+		label += "(not evaluated)"
+	}
+	writeTreeLine(&b, level, tail, label)
+	for _, child := range e.Children[above:] {
+		b.Write(child.format(level+1, true))
+	}
+	return b.Bytes()
+}
+
+func formatValue(v interface{}) string {
+	switch r := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return fmt.Sprintf("%q", r)
+	case time.Time:
+		return r.Format(time.RFC3339Nano)
+	case error:
+		return "error(" + r.Error() + ")"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// explainTrace collects the values of the nodes during one evaluation.
+type explainTrace struct {
+	values map[ExprNode]interface{}
+}
+
+// explain calculates the value of expression, and returns the evaluated expression tree.
+func (p *Expr) explain(ctx context.Context, field string, tagExpr *TagExpr) *Explanation {
+	t := &explainTrace{values: make(map[ExprNode]interface{})}
+	// the expression is compiled again with the trace, so that the normal evaluation records nothing
+	c := &compiler{field: field, trace: t}
+	env, _ := ctx.Value(variableKey).(map[string]interface{})
+	r := normalizeNumber(c.compile(p.expr).fn.eval(ctx, field, tagExpr, env))
+	a := p.explainNode(t, p.expr)
+	if len(a) == 1 {
+		a[0].Value = r
+		return a[0]
+	}
+	// e.g. the empty expression
+	return &Explanation{Expr: p.src, Value: r, Evaluated: true, Children: a}
+}
+
+// explainNode returns the explanations of @node.
+// NOTE:
+//
+//	The node without source position, e.g. the group of a function argument,
+//	is replaced by the explanations of its children.
+func (p *Expr) explainNode(t *explainTrace, node ExprNode) []*Explanation {
+	var children []*Explanation
+	for _, child := range childrenOf(node) {
+		children = append(children, p.explainNode(t, child)...)
+	}
+	start, end := posOf(node), endOf(node)
+	if end == 0 {
+		return children
+	}
+	for _, child := range children {
+		if child.Offset < start {
+			start = child.Offset
+		}
+		if e := child.Offset + len(child.Expr); e > end {
+			end = e
+		}
+	}
+	if end > len(p.src) {
+		end = len(p.src)
+	}
+	if start > end {
+		start = end
+	}
+	v, ok := t.values[node]
+	return []*Explanation{{
+		Expr:      p.src[start:end],
+		Node:      node.String(),
+		Offset:    start,
+		Value:     normalizeNumber(v),
+		Evaluated: ok,
+		Children:  children,
+	}}
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr_test
+
+import (
+	"testing"
+
+	"github.com/bytedance/go-tagexpr/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	type T struct {
+		A int    `te:"$>(B)$ && len((C)$)<3"`
+		B int    `te:"max(1, (A)$)>2 ? 'big' : !in($, 2, 3)"`
+		C string `te:"len($)"`
+	}
+	vm := tagexpr.New("te")
+	te := vm.MustRun(&T{A: 5, B: 1, C: "abcd"})
+
+	e := te.Explain("A")
+	assert.Equal(t, "$>(B)$ && len((C)$)<3", e.Expr)
+	assert.Equal(t, "&&", e.Node)
+	assert.Equal(t, false, e.Value)
+	assert.Len(t, e.Children, 2)
+	gt, lt := e.Children[0], e.Children[1]
+	assert.Equal(t, "$>(B)$", gt.Expr)
+	assert.Equal(t, true, gt.Value)
+	assert.Equal(t, "len((C)$)<3", lt.Expr)
+	assert.Equal(t, 10, lt.Offset)
+	assert.Equal(t, false, lt.Value)
+	assert.Equal(t, "len((C)$)", lt.Children[0].Expr)
+	assert.Equal(t, 4.0, lt.Children[0].Value)
+	assert.Equal(t, "(C)$", lt.Children[0].Children[0].Expr)
+	assert.Equal(t, "abcd", lt.Children[0].Children[0].Value)
+	assert.Equal(t, ""+
+		"        ┌── $ => 5\n"+
+		"    ┌── $>(B)$ => true\n"+
+		"        └── (B)$ => 1\n"+
+		"└── $>(B)$ && len((C)$)<3 => false\n"+
+		"        ┌── len((C)$) => 4\n"+
+		"            └── (C)$ => \"abcd\"\n"+
+		"    └── len((C)$)<3 => false\n"+
+		"        └── 3 => 3\n",
+		e.String())
+
+	// the skipped branch
+	e = te.Explain("B")
+	assert.Equal(t, "big", e.Value)
+	assert.Len(t, e.Children, 3)
+	assert.Equal(t, "max(1, (A)$)>2", e.Children[0].Expr)
+	assert.True(t, e.Children[1].Evaluated)
+	assert.Equal(t, "!in($, 2, 3)", e.Children[2].Expr)
+	assert.False(t, e.Children[2].Evaluated)
+
+	// the short-circuit
+	te = vm.MustRun(&T{A: 0, B: 1, C: "ab"})
+	e = te.Explain("A")
+	assert.Equal(t, false, e.Children[0].Value)
+	assert.False(t, e.Children[1].Evaluated)
+
+	assert.Nil(t, te.Explain("D"))
+	err := te.Range(func(eh *tagexpr.ExprHandler) error {
+		assert.Equal(t, eh.Eval(), eh.Explain().Value)
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -19,45 +19,76 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/andeya/goutil"
 )
 
 type variableKeyType string
+
 const variableKey variableKeyType = "__ENV_KEY__"
 
 // Expr expression
 type Expr struct {
-	expr ExprNode
+	expr  ExprNode
+	src   string
+	funcs map[string]func(p *Expr, expr *string) ExprNode // resolved before the global funcList
+	err   error                                           // the first error when parsing
+	end   int                                             // the end offset of the (sub-)expression being parsed
+	fn    evalFunc                                        // the compiled closures, nil if not compiled
 }
 
-// parseExpr parses the expression.
+// parseExpr parses the expression with the global functions.
 func parseExpr(expr string) (*Expr, error) {
+	return parseExprWithFuncs(expr, nil)
+}
+
+// parseExprWithFuncs parses the expression,
+// and @funcs shadows the global functions with the same names.
+func parseExprWithFuncs(expr string, funcs map[string]func(p *Expr, expr *string) ExprNode) (*Expr, error) {
 	e := newGroupExprNode()
 	p := &Expr{
-		expr: e,
+		expr:  e,
+		src:   expr,
+		funcs: funcs,
+		end:   len(expr),
 	}
 	s := expr
-	err := p.parseExprNode(&s, e)
+	err := p.parseLetExprNode(&s, e)
 	if err != nil {
 		return nil, err
 	}
+	if trimLeftSpace(&s); s != "" {
+		return nil, p.syntaxError(s, "operator or end of expression")
+	}
 	sortPriority(e)
+	if err = p.optimize(); err != nil {
+		return nil, err
+	}
 	return p, nil
 }
+
 func (p *Expr) parseExprNode(expr *string, e ExprNode) error {
 	trimLeftSpace(expr)
 	if *expr == "" {
 		return nil
 	}
+	last := *expr
 	operand := p.readSelectorExprNode(expr)
-	if operand == nil {
+	if operand == nil && p.err == nil {
 		operand = p.readRangeKvExprNode(expr)
 		if operand == nil {
 			var subExprNode *string
 			operand, subExprNode = readGroupExprNode(expr)
 			if operand != nil {
+				restore := p.window(p.offsetOf(*expr) - 1)
 				err := p.parseExprNode(subExprNode, operand)
+				if err == nil {
+					if trimLeftSpace(subExprNode); *subExprNode != "" {
+						err = p.syntaxError(*subExprNode, "operator or ')'")
+					}
+				}
+				restore()
 				if err != nil {
 					return err
 				}
@@ -66,16 +97,37 @@ func (p *Expr) parseExprNode(expr *string, e ExprNode) error {
 			}
 		}
 	}
+	if p.err != nil {
+		return p.err
+	}
 	if operand == nil {
-		return fmt.Errorf("syntax error: %q", *expr)
+		if strings.HasPrefix(strings.TrimLeft(last, "!+-"), "(") {
+			return p.syntaxErrorAt(p.offsetOf(last)+len(last), "')'")
+		}
+		return p.syntaxError(last, "operand")
 	}
+	setPos(operand, p.offsetOf(last))
+	setEnd(operand, p.offsetOf(last)+len(last)-len(*expr))
 	trimLeftSpace(expr)
+	last = *expr
 	operator := p.parseOperator(expr)
+	if operator != nil {
+		setPos(operator, p.offsetOf(last))
+		setEnd(operator, p.offsetOf(last)+len(last)-len(*expr))
+	}
 	if operator == nil {
 		e.SetRightOperand(operand)
 		operand.SetParent(e)
 		return nil
 	}
+	if ternary, ok := operator.(*ternaryExprNode); ok {
+		e.SetRightOperand(operand)
+		operand.SetParent(e)
+		return p.parseTernary(expr, e, ternary)
+	}
+	if trimLeftSpace(expr); *expr == "" {
+		return p.syntaxErrorAt(p.offsetOf(last)+len(last), "operand")
+	}
 	if _, ok := e.(*groupExprNode); ok {
 		operator.SetLeftOperand(operand)
 		operand.SetParent(operator)
@@ -92,9 +144,95 @@ func (p *Expr) parseExprNode(expr *string, e ExprNode) error {
 	return p.parseExprNode(expr, operator)
 }
 
+// parseTernary parses the branches of the ternary expression.
+// NOTE:
+//
+//	Since ?: has the lowest priority, the condition is
+//	everything that has been parsed in the current group.
+func (p *Expr) parseTernary(expr *string, e ExprNode, ternary ExprNode) error {
+	grp := e
+	for {
+		if _, ok := grp.(*groupExprNode); ok {
+			break
+		}
+		grp = grp.Parent()
+	}
+	sortPriority(grp)
+	cond := grp.RightOperand()
+	ternary.SetLeftOperand(cond)
+	cond.SetParent(ternary)
+	grp.SetRightOperand(ternary)
+	ternary.SetParent(grp)
+
+	branches := newTernaryBranchesExprNode()
+	ternary.SetRightOperand(branches)
+	branches.SetParent(ternary)
+	for i := 0; i < 2; i++ {
+		if i == 1 {
+			if trimLeftSpace(expr); !strings.HasPrefix(*expr, ":") {
+				return p.syntaxError(*expr, "':'")
+			}
+			*expr = (*expr)[1:]
+		}
+		last := *expr
+		branch := newGroupExprNode()
+		err := p.parseExprNode(expr, branch)
+		if err != nil {
+			return err
+		}
+		if branch.RightOperand() == nil {
+			return p.syntaxErrorAt(p.offsetOf(last)+len(last)-len(*expr), "operand")
+		}
+		sortPriority(branch)
+		if i == 0 {
+			branches.SetLeftOperand(branch)
+		} else {
+			branches.SetRightOperand(branch)
+		}
+		branch.SetParent(branches)
+	}
+	return nil
+}
+
+// offsetOf returns the byte offset of the unparsed remainder @last in the source expression.
+// NOTE:
+//
+//	@last must be a suffix of the (sub-)expression being parsed, see window;
+//	the offsets in the sub-expression whose escape characters were removed are approximate.
+func (p *Expr) offsetOf(last string) int {
+	if offset := p.end - len(last); offset > 0 {
+		return offset
+	}
+	return 0
+}
+
+// window sets the end offset of the sub-expression to be parsed, e.g. the arguments in the parentheses,
+// and returns the function restoring the outer one.
+func (p *Expr) window(end int) (restore func()) {
+	outer := p.end
+	p.end = end
+	return func() { p.end = outer }
+}
+
+func (p *Expr) syntaxError(last string, expected string) error {
+	return p.syntaxErrorAt(p.offsetOf(last), expected)
+}
+
+func (p *Expr) syntaxErrorAt(offset int, expected string) error {
+	return &SyntaxError{Expr: p.src, Offset: offset, Expected: expected}
+}
+
+// setErr records the first error found by the operand readers,
+// which can not return an error.
+func (p *Expr) setErr(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
 func (p *Expr) parseOperand(expr *string) (e ExprNode) {
-	for _, fn := range funcList {
-		if e = fn(p, expr); e != nil {
+	if fn := p.lookupFunc(*expr); fn != nil {
+		if e = fn(p, expr); e != nil || p.err != nil {
 			return e
 		}
 	}
@@ -110,86 +248,138 @@ func (p *Expr) parseOperand(expr *string) (e ExprNode) {
 	if e = readNilExprNode(expr); e != nil {
 		return e
 	}
+	last := *expr
 	if e = readVariableExprNode(expr); e != nil {
+		if strings.HasPrefix(*expr, "(") {
+			p.setErr(&SyntaxError{Expr: p.src, Offset: p.offsetOf(last), Msg: fmt.Sprintf("unknown function %q", e.String())})
+			return nil
+		}
 		return e
 	}
 	return nil
 }
 
-func (*Expr) parseOperator(expr *string) (e ExprNode) {
-	s := *expr
-	if len(s) < 2 {
+// lookupFunc returns the reader of the function called at the head of expr, e.g. max for -max($, 1),
+// which is resolved from @funcs, funcList and builtinFuncList in order.
+func (p *Expr) lookupFunc(expr string) func(p *Expr, expr *string) ExprNode {
+	last := strings.TrimLeft(expr, "!+-")
+	i := strings.IndexByte(last, '(')
+	if i <= 0 {
 		return nil
 	}
-	defer func() {
-		if e != nil && *expr == s {
-			*expr = (*expr)[2:]
+	name := last[:i]
+	if fn, ok := p.funcs[name]; ok {
+		return fn
+	}
+	if fn, ok := funcList[name]; ok {
+		return fn
+	}
+	return builtinFuncList[name]
+}
+
+func (*Expr) parseOperator(expr *string) (e ExprNode) {
+	s := *expr
+	if len(s) >= 2 {
+		switch s[:2] {
+		case "<<":
+			e = newShiftLeftExprNode()
+		case ">>":
+			e = newShiftRightExprNode()
+		case "&^":
+			e = newBitClearExprNode()
+		case "||":
+			e = newOrExprNode()
+		case "&&":
+			e = newAndExprNode()
+		case "==":
+			e = newEqualExprNode()
+		case ">=":
+			e = newGreaterEqualExprNode()
+		case "<=":
+			e = newLessEqualExprNode()
+		case "!=":
+			e = newNotEqualExprNode()
 		}
-	}()
-	a := s[:2]
-	switch a {
-	// case "<<":
-	// case ">>":
-	// case "&^":
-	case "||":
-		return newOrExprNode()
-	case "&&":
-		return newAndExprNode()
-	case "==":
-		return newEqualExprNode()
-	case ">=":
-		return newGreaterEqualExprNode()
-	case "<=":
-		return newLessEqualExprNode()
-	case "!=":
-		return newNotEqualExprNode()
-	}
-	defer func() {
 		if e != nil {
-			*expr = (*expr)[1:]
+			*expr = s[2:]
+			return e
 		}
-	}()
-	switch a[0] {
-	// case '&':
-	// case '|':
-	// case '^':
+	}
+	if len(s) == 0 {
+		return nil
+	}
+	switch s[0] {
+	case '&':
+		e = newBitAndExprNode()
+	case '|':
+		e = newBitOrExprNode()
+	case '^':
+		e = newBitXorExprNode()
+	case '?':
+		e = newTernaryExprNode()
 	case '+':
-		return newAdditionExprNode()
+		e = newAdditionExprNode()
 	case '-':
-		return newSubtractionExprNode()
+		e = newSubtractionExprNode()
 	case '*':
-		return newMultiplicationExprNode()
+		e = newMultiplicationExprNode()
 	case '/':
-		return newDivisionExprNode()
+		e = newDivisionExprNode()
 	case '%':
-		return newRemainderExprNode()
+		e = newRemainderExprNode()
 	case '<':
-		return newLessExprNode()
+		e = newLessExprNode()
 	case '>':
-		return newGreaterExprNode()
+		e = newGreaterExprNode()
 	}
-	return nil
+	if e != nil {
+		*expr = s[1:]
+	}
+	return e
 }
 
 // run calculates the value of expression.
+// NOTE:
+//
+//	The number result is always float64.
 func (p *Expr) run(field string, tagExpr *TagExpr) interface{} {
-	return p.expr.Run(context.Background(), field, tagExpr)
+	return p.runContext(context.Background(), field, tagExpr)
+}
+
+// runContext calculates the value of expression with the context,
+// which is passed to the functions registered by RegFuncCtx.
+func (p *Expr) runContext(ctx context.Context, field string, tagExpr *TagExpr) interface{} {
+	// the env carried by VM.WithEnv
+	env, _ := ctx.Value(variableKey).(map[string]interface{})
+	return normalizeNumber(p.evaluate(ctx, field, tagExpr, env))
 }
 
 func (p *Expr) runWithEnv(field string, tagExpr *TagExpr, env map[string]interface{}) interface{} {
-	ctx := context.WithValue(context.Background(), variableKey, env)
+	return normalizeNumber(p.evaluate(context.Background(), field, tagExpr, env))
+}
+
+// evaluate calculates the value of expression with the env,
+// and the number result is int64, uint64 or float64.
+func (p *Expr) evaluate(ctx context.Context, field string, tagExpr *TagExpr, env map[string]interface{}) interface{} {
+	if p.fn != nil {
+		return p.fn.eval(ctx, field, tagExpr, env)
+	}
+	if env != nil {
+		ctx = context.WithValue(ctx, variableKey, env)
+	}
 	return p.expr.Run(ctx, field, tagExpr)
 }
 
 /**
  * Priority:
  * () ! bool float64 string nil
- * * / %
- * + -
+ * * / % << >> & &^
+ * + - | ^
  * < <= > >=
  * == !=
  * &&
  * ||
+ * ?:
 **/
 
 func sortPriority(e ExprNode) {
@@ -237,9 +427,10 @@ func getPriority(e ExprNode) (i int) {
 	switch e.(type) {
 	default: // () ! bool float64 string nil
 		return 7
-	case *multiplicationExprNode, *divisionExprNode, *remainderExprNode: // * / %
+	case *multiplicationExprNode, *divisionExprNode, *remainderExprNode,
+		*shiftLeftExprNode, *shiftRightExprNode, *bitAndExprNode, *bitClearExprNode: // * / % << >> & &^
 		return 6
-	case *additionExprNode, *subtractionExprNode: // + -
+	case *additionExprNode, *subtractionExprNode, *bitOrExprNode, *bitXorExprNode: // + - | ^
 		return 5
 	case *lessExprNode, *lessEqualExprNode, *greaterExprNode, *greaterEqualExprNode: // < <= > >=
 		return 4
@@ -249,7 +440,39 @@ func getPriority(e ExprNode) (i int) {
 		return 2
 	case *orExprNode: // ||
 		return 1
+	case *ternaryExprNode, *ternaryBranchesExprNode: // ?:
+		return 0
+	}
+}
+
+// childrenOf returns the child nodes of @node, including the function arguments
+// which are not linked as the left or right operand.
+func childrenOf(node ExprNode) []ExprNode {
+	var a []ExprNode
+	switch e := node.(type) {
+	case *funcExprNode:
+		a = append(a, e.args...)
+	case *sprintfFuncExprNode:
+		a = append(a, e.args...)
+	case *selectorExprNode:
+		a = append(a, e.subExprs...)
+	case *regexpFuncExprNode:
+		if e.pattern != nil {
+			a = append(a, e.pattern)
+		}
+	case *rangeFuncExprNode:
+		a = append(a, e.object, e.elemExprNode)
+	case *collectionFuncExprNode:
+		a = append(a, e.object, e.elemExprNode)
 	}
+	a = append(a, node.LeftOperand(), node.RightOperand())
+	r := a[:0]
+	for _, child := range a {
+		if child != nil {
+			r = append(r, child)
+		}
+	}
+	return r
 }
 
 // ExprNode expression interface
@@ -270,6 +493,54 @@ type exprBackground struct {
 	parent       ExprNode
 	leftOperand  ExprNode
 	rightOperand ExprNode
+	offset       int // the byte offset in the source expression
+	end          int // the end byte offset in the source expression, 0 if unknown
+}
+
+func (eb *exprBackground) pos() int {
+	return eb.offset
+}
+
+func (eb *exprBackground) setPos(offset int) {
+	eb.offset = offset
+}
+
+func (eb *exprBackground) endPos() int {
+	return eb.end
+}
+
+func (eb *exprBackground) setEnd(end int) {
+	eb.end = end
+}
+
+// setPos records the byte offset of @e in the source expression.
+func setPos(e ExprNode, offset int) {
+	if n, ok := e.(interface{ setPos(int) }); ok {
+		n.setPos(offset)
+	}
+}
+
+// posOf returns the byte offset of @e in the source expression.
+func posOf(e ExprNode) int {
+	if n, ok := e.(interface{ pos() int }); ok {
+		return n.pos()
+	}
+	return 0
+}
+
+// setEnd records the end byte offset of @e in the source expression.
+func setEnd(e ExprNode, end int) {
+	if n, ok := e.(interface{ setEnd(int) }); ok {
+		n.setEnd(end)
+	}
+}
+
+// endOf returns the end byte offset of @e in the source expression, 0 if unknown.
+func endOf(e ExprNode) int {
+	if n, ok := e.(interface{ endPos() int }); ok {
+		return n.endPos()
+	}
+	return 0
 }
 
 func (eb *exprBackground) SetParent(e ExprNode) {
@@ -322,18 +593,21 @@ func formatExprNode(node ExprNode, level int, tail bool) []byte {
 	if node == nil {
 	} else {
 		b.Write(formatExprNode(node.LeftOperand(), level+1, false))
-
-		b.Write(bytes.Repeat([]byte("    "), level))
-		if tail {
-			b.Write([]byte("└── "))
-		} else {
-			b.Write([]byte("┌── "))
-		}
-
-		b.Write([]byte(node.String()))
-		b.Write([]byte("\n"))
-
+		writeTreeLine(&b, level, tail, node.String())
 		b.Write(formatExprNode(node.RightOperand(), level+1, true))
 	}
 	return b.Bytes()
 }
+
+// writeTreeLine writes the line of the tree node,
+// the nodes above their parent are not @tail.
+func writeTreeLine(b *bytes.Buffer, level int, tail bool, label string) {
+	b.Write(bytes.Repeat([]byte("    "), level))
+	if tail {
+		b.Write([]byte("└── "))
+	} else {
+		b.Write([]byte("┌── "))
+	}
+	b.WriteString(label)
+	b.WriteString("\n")
+}
@@ -18,6 +18,8 @@ import (
 	"math"
 	"reflect"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestExpr(t *testing.T) {
@@ -202,12 +204,20 @@ func TestBuiltInFunc(t *testing.T) {
 		{expr: "regexp('^a\\d$','a0')", val: true},
 		{expr: "regexp('a\\d','a')", val: false},
 		{expr: "regexp('^a\\d$','a')", val: false},
+		{expr: "regexp('^'+'a','a')", val: true},
+		{expr: "!regexp(sprintf('^%s$', 'a'+'b'),'ab')", val: false},
 
 		{expr: "sprintf('test string: %s','a')", val: "test string: a"},
 		{expr: "sprintf('test string: %s','a'+'b')", val: "test string: ab"},
 		{expr: "sprintf('test string: %s,%v','a',1)", val: "test string: a,1"},
 		{expr: "sprintf('')+'a'", val: "a"},
 		{expr: "sprintf('%v',10+2*2)", val: "14"},
+		{expr: "sprintf('%.1f', 3)", val: "3.0"},
+		{expr: "sprintf('%d|%x|%v', 3, 255, 9007199254740993)", val: "3|ff|9007199254740993"},
+		{expr: "sprintf('%d', len('abc'))", val: "3"},
+		{expr: "sprintf('%[2]d-%.1[1]f', 1, 2)", val: "2-1.0"},
+		{expr: "sprintf('%*d|%%|%g', 3, 7, 2)", val: "  7|%|2"},
+		{expr: "sprintf('%.2f', 9007199254740993 - 9007199254740992)", val: "1.00"},
 	}
 	for _, c := range cases {
 		t.Log(c.expr)
@@ -231,7 +241,8 @@ func TestSyntaxIncorrect(t *testing.T) {
 	}{
 		{incorrectExpr: "1 + + 'a'"},
 		{incorrectExpr: "regexp()"},
-		{incorrectExpr: "regexp('^'+'a','a')"},
+		{incorrectExpr: "regexp(x,'a')"},
+		{incorrectExpr: "regexp(1+1,'a')"},
 		{incorrectExpr: "regexp('^a','a','b')"},
 		{incorrectExpr: "sprintf()"},
 		{incorrectExpr: "sprintf(0)"},
@@ -246,3 +257,258 @@ func TestSyntaxIncorrect(t *testing.T) {
 		}
 	}
 }
+
+func TestSyntaxError(t *testing.T) {
+	var cases = []struct {
+		expr     string
+		offset   int
+		expected string
+		msg      string
+	}{
+		{expr: "1 + + 'a'", offset: 4, expected: "operand"},
+		{expr: "1+", offset: 2, expected: "operand"},
+		{expr: "1 2", offset: 2, expected: "operator or end of expression"},
+		{expr: "(1 2)", offset: 3, expected: "operator or ')'"},
+		{expr: "(1+2", offset: 4, expected: "')'"},
+		{expr: "len($", offset: 5, expected: "')'"},
+		{expr: "len($ $)", offset: 6, expected: "operator, ',' or ')'"},
+		{expr: "sprintf('%v', 1 +)", offset: 17, expected: "operand"},
+		{expr: "regexp('[a')", offset: 8, msg: "error parsing regexp: missing closing ]: `[a`"},
+		{expr: "regexp('['+'a')", offset: 7, msg: "error parsing regexp: missing closing ]: `[a`"},
+		{expr: "regexp(len($)>0)", offset: 7, expected: "constant regular expression string"},
+		{expr: "matches($, '['+'a')", offset: 11, msg: "error parsing regexp: missing closing ]: `[a`"},
+		{expr: "$ > 0 && foo($)", offset: 9, msg: `unknown function "foo"`},
+		{expr: "maxx(1, 2) + inmax(1)", offset: 0, msg: `unknown function "maxx"`},
+		{expr: "(1 + (2 *)) > 0", offset: 9, expected: "operand"},
+		{expr: "len($[1 +]) > 0", offset: 9, expected: "operand"},
+		{expr: "$[ 1 2 :3]", offset: 5, expected: "operator or ']'"},
+		{expr: "$[1: 2 3 ]", offset: 7, expected: "operator or ']'"},
+		{expr: "max(1, len('a') +) > 0", offset: 17, expected: "operand"},
+	}
+	for _, c := range cases {
+		_, err := parseExpr(c.expr)
+		e, ok := err.(*SyntaxError)
+		if !ok {
+			t.Fatalf("expr: %q, expect *SyntaxError, but got: %v", c.expr, err)
+		}
+		if e.Offset != c.offset || e.Expected != c.expected || e.Msg != c.msg {
+			t.Fatalf("expr: %q, got: %d %q %q, expect: %d %q %q", c.expr, e.Offset, e.Expected, e.Msg, c.offset, c.expected, c.msg)
+		}
+		t.Log(err)
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	var calls []interface{}
+	MustRegFunc("trace", func(args ...interface{}) interface{} {
+		calls = append(calls, args[0])
+		return args[1]
+	}, true)
+	var cases = []struct {
+		expr  string
+		val   interface{}
+		calls []interface{}
+	}{
+		{expr: "false && trace(1, true)", val: false},
+		{expr: "true || trace(1, true)", val: true},
+		{expr: "trace(1, true) && trace(2, false)", val: false, calls: []interface{}{1.0, 2.0}},
+		{expr: "trace(1, false) || trace(2, true)", val: true, calls: []interface{}{1.0, 2.0}},
+		{expr: "trace(1, false) && trace(2, true) || trace(3, true)", val: true, calls: []interface{}{1.0, 3.0}},
+		{expr: "trace(1, true) || trace(2, true) && trace(3, true)", val: true, calls: []interface{}{1.0}},
+		{expr: "false && trace(1, 1) + trace(2, 2) > 0 && trace(3, true)", val: false},
+		{expr: "1 > 2 && (trace(1, true) || trace(2, true))", val: false},
+		{expr: "!(1 < 2) && len(trace(1, 'a')) > 0", val: false},
+		{expr: "sprintf('%v', true || trace(1, true))", val: "true"},
+		{expr: "trace(1, 0) || trace(2, '') || trace(3, nil) || trace(4, 'x')", val: true, calls: []interface{}{1.0, 2.0, 3.0, 4.0}},
+	}
+	for _, c := range cases {
+		calls = nil
+		vm, err := parseExpr(c.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		val := vm.run("", nil)
+		if !reflect.DeepEqual(val, c.val) || !reflect.DeepEqual(calls, c.calls) {
+			t.Fatalf("expr: %q, got: %v %v, expect: %v %v", c.expr, val, calls, c.val, c.calls)
+		}
+	}
+}
+
+func TestTernary(t *testing.T) {
+	var calls []interface{}
+	MustRegFunc("trace", func(args ...interface{}) interface{} {
+		calls = append(calls, args[0])
+		return args[1]
+	}, true)
+	var cases = []struct {
+		expr  string
+		val   interface{}
+		calls []interface{}
+	}{
+		{expr: "true ? 'a' : 'b'", val: "a"},
+		{expr: "false?'a':'b'", val: "b"},
+		{expr: "1 > 2 || 3 > 2 ? 1+1 : 2*2", val: 2.0},
+		{expr: "1 > 2 ? 'a' : 2 > 1 ? 'b' : 'c'", val: "b"},
+		{expr: "true ? false ? 'a' : 'b' : 'c'", val: "b"},
+		{expr: "(true ? 1 : 2) + 10", val: 11.0},
+		{expr: "sprintf('%v', nil ? 'x' : 'y')", val: "y"},
+		{expr: "'p' + (0 ? 'x' : 'y')", val: "py"},
+		{expr: "trace(1, true) ? trace(2, 'a') : trace(3, 'b')", val: "a", calls: []interface{}{1.0, 2.0}},
+		{expr: "trace(1, '') ? trace(2, 'a') : trace(3, 'b')", val: "b", calls: []interface{}{1.0, 3.0}},
+	}
+	for _, c := range cases {
+		calls = nil
+		vm, err := parseExpr(c.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		val := vm.run("", nil)
+		if !reflect.DeepEqual(val, c.val) || !reflect.DeepEqual(calls, c.calls) {
+			t.Fatalf("expr: %q, got: %v %v, expect: %v %v", c.expr, val, calls, c.val, c.calls)
+		}
+	}
+	for _, expr := range []string{"true ? 1", "true ? : 1", "true ? 1 :", "? 1 : 2"} {
+		_, err := parseExpr(expr)
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Fatalf("expr: %q, expect *SyntaxError, but got: %v", expr, err)
+		}
+	}
+	vm, _ := parseExpr("$ > 0 ? 'a' : 'b'")
+	assert.Equal(t, "    └── ()\n"+
+		"                ┌── ()$\n"+
+		"            ┌── >\n"+
+		"                └── 0\n"+
+		"        └── ?\n"+
+		"                ┌── ()\n"+
+		"                    └── a\n"+
+		"            └── :\n"+
+		"                └── ()\n"+
+		"                    └── b\n", string(formatExprNode(vm.expr, 1, true)))
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	var cases = []struct {
+		expr string
+		val  interface{}
+	}{
+		{expr: "9007199254740993 == 9007199254740992", val: false},
+		{expr: "9007199254740993 > 9007199254740992", val: true},
+		{expr: "9007199254740993 - 9007199254740992", val: 1.0},
+		{expr: "9007199254740993 % 10", val: 3.0},
+		{expr: "9223372036854775807 + 9223372036854775808 > 9223372036854775807", val: true},
+		{expr: "18446744073709551615 > 9223372036854775807", val: true},
+		{expr: "18446744073709551615 - 18446744073709551614", val: 1.0},
+		{expr: "-9223372036854775808 < 9223372036854775807", val: true},
+		{expr: "-7 % 3", val: -1.0},
+		{expr: "7 % -3", val: 1.0},
+		{expr: "7/2", val: 3.5}, // not the integer division
+		{expr: "1/0", val: math.NaN()},
+		{expr: "6/3 == 2", val: true},
+		{expr: "1 == 1.0", val: true},
+		{expr: "9007199254740993 == 9007199254740992.0", val: false},
+		{expr: "9007199254740992 == 9007199254740992.0", val: true},
+		{expr: "1 < 1.5", val: true},
+		{expr: "1.5%0", val: math.NaN()},
+		{expr: "'3' * 2", val: 6.0},
+	}
+	for _, c := range cases {
+		vm, err := parseExpr(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		val := vm.run("", nil)
+		if f, ok := c.val.(float64); ok && math.IsNaN(f) {
+			assert.True(t, math.IsNaN(val.(float64)), c.expr)
+			continue
+		}
+		assert.Equal(t, c.val, val, c.expr)
+	}
+
+	for _, c := range []struct {
+		expr string
+		err  string
+	}{
+		{expr: "9223372036854775807 + 1", err: "integer overflow: 9223372036854775807 + 1"},
+		{expr: "-9223372036854775807 - 2", err: "integer overflow"},
+		{expr: "4611686018427387904 * 2", err: "integer overflow"},
+		{expr: "18446744073709551615 + 1", err: "integer overflow"},
+		{expr: "-9223372036854775808 - 18446744073709551615", err: "integer overflow"},
+		{expr: "9223372036854775807 * 3", err: "integer overflow"},
+		{expr: "1 << 70", err: "integer overflow"},
+		{expr: "1 % 0", err: "integer divide by zero: 1 % 0"},
+		{expr: "(9223372036854775807 + 1) > 0", err: "integer overflow"},
+		{expr: "true && 9223372036854775807 + 1 > 0", err: "integer overflow"},
+		{expr: "!(1 % 0)", err: "integer divide by zero"},
+		{expr: "1 % 0 == 0 ? 1 : 2", err: "integer divide by zero"},
+		{expr: "abs(1 << 70)", err: "integer overflow"},
+	} {
+		vm, err := parseExpr(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		err, _ = vm.run("", nil).(error)
+		if assert.Error(t, err, c.expr) {
+			assert.Contains(t, err.Error(), c.err, c.expr)
+		}
+		_, err = MustCompile(c.expr).Eval(nil)
+		if assert.Error(t, err, c.expr) {
+			assert.Contains(t, err.Error(), c.err, c.expr)
+		}
+	}
+	// the short-circuit skips the error
+	v, err := MustCompile("false && 1 % 0 == 0").Eval(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, false, v)
+}
+
+func TestBitwise(t *testing.T) {
+	var cases = []struct {
+		expr string
+		val  interface{}
+	}{
+		{expr: "0x0F", val: 15.0},
+		{expr: "0XfF", val: 255.0},
+		{expr: "0o17", val: 15.0},
+		{expr: "0b101", val: 5.0},
+		{expr: "-0x10", val: -16.0},
+		{expr: "010", val: 10.0},
+		{expr: "0x3C & 0x0F", val: 12.0},
+		{expr: "0x30 | 0x0F", val: 63.0},
+		{expr: "0b110 ^ 0b011", val: 5.0},
+		{expr: "0b111 &^ 0b010", val: 5.0},
+		{expr: "1 << 4", val: 16.0},
+		{expr: "-16 >> 2", val: -4.0},
+		{expr: "(0x1F & 0x0F) != 0", val: true},
+		{expr: "0x1F & 0x0F != 0", val: true},
+		{expr: "1 + 2 & 3", val: 3.0},
+		{expr: "1 | 2 * 4", val: 9.0},
+		{expr: "1 | 6 ^ 3", val: 4.0},
+		{expr: "1 << 2 + 1", val: 5.0},
+		{expr: "7 & 3 == 3 && 8 | 1 == 9", val: true},
+		{expr: "1 << 63 == 9223372036854775808", val: true},
+		{expr: "0xFFFFFFFFFFFFFFFF & 0xFF", val: 255.0},
+		{expr: "-1 & 0xFFFFFFFFFFFFFFFF == 0xFFFFFFFFFFFFFFFF", val: true},
+		{expr: "4.0 >> 1", val: 2.0},
+	}
+	for _, c := range cases {
+		vm, err := parseExpr(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		assert.Equal(t, c.val, vm.run("", nil), c.expr)
+	}
+
+	for expr, msg := range map[string]string{
+		"1.5 & 1":  "non-integer operand of &: 1.5",
+		"1 << -1":  "negative shift count: -1",
+		"1 << 64":  "integer overflow: 1 << 64",
+		"3 >> 0.5": "non-integer operand of >>: 0.5",
+	} {
+		vm, err := parseExpr(expr)
+		if !assert.NoError(t, err, expr) {
+			continue
+		}
+		err, _ = vm.run("", nil).(error)
+		assert.EqualError(t, err, msg, expr)
+	}
+}
@@ -1,6 +1,9 @@
 package tagexpr
 
-import "reflect"
+import (
+	"context"
+	"reflect"
+)
 
 // FieldHandler field handler
 type FieldHandler struct {
@@ -58,14 +61,16 @@ type ExprHandler struct {
 	base       string
 	path       string
 	selector   string
+	index      int
 	expr       *TagExpr
 	targetExpr *TagExpr
 }
 
-func newExprHandler(te, tte *TagExpr, base, es string) *ExprHandler {
+func newExprHandler(te, tte *TagExpr, base, es string, index int) *ExprHandler {
 	return &ExprHandler{
 		base:       base,
 		selector:   es,
+		index:      index,
 		expr:       te,
 		targetExpr: tte,
 	}
@@ -86,6 +91,17 @@ func (e *ExprHandler) ExprSelector() ExprSelector {
 	return ExprSelector(e.selector)
 }
 
+// Index returns the position of the expression in the declared order of the struct,
+// i.e. the order of the fields and the order in the tag.
+func (e *ExprHandler) Index() int {
+	return e.index
+}
+
+// Priority returns the priority of the expression set by the tag, 0 by default.
+func (e *ExprHandler) Priority() int {
+	return e.expr.s.exprPriorities[e.index]
+}
+
 // Path returns the path description of the expression.
 func (e *ExprHandler) Path() string {
 	if e.path == "" {
@@ -100,11 +116,31 @@ func (e *ExprHandler) Path() string {
 
 // Eval evaluate the value of the struct tag expression.
 // NOTE:
-//  result types: float64, string, bool, nil
+//  result types: float64, string, bool, time.Time, time.Duration, nil
 func (e *ExprHandler) Eval() interface{} {
 	return e.expr.s.exprs[e.selector].run(e.base, e.targetExpr)
 }
 
+// EvalContext evaluates the value of the struct tag expression with the context,
+// which is passed to the functions registered by RegFuncCtx.
+// NOTE:
+//  result types: float64, string, bool, time.Time, time.Duration, nil
+func (e *ExprHandler) EvalContext(ctx context.Context) interface{} {
+	return e.expr.s.exprs[e.selector].runContext(ctx, e.base, e.targetExpr)
+}
+
+// Explain evaluates the struct tag expression,
+// and returns the evaluated expression tree, which shows the value of every sub-expression.
+func (e *ExprHandler) Explain() *Explanation {
+	return e.ExplainContext(context.Background())
+}
+
+// ExplainContext is similar to Explain, but with the context,
+// which is passed to the functions registered by RegFuncCtx.
+func (e *ExprHandler) ExplainContext(ctx context.Context) *Explanation {
+	return e.expr.s.exprs[e.selector].explain(ctx, e.base, e.targetExpr)
+}
+
 // EvalFloat evaluates the value of the struct tag expression.
 // NOTE:
 //  If the expression value type is not float64, return 0.
@@ -0,0 +1,255 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"time"
+)
+
+// --------------------------- Optimizer ---------------------------
+
+// constExprNode the constant sub-expression folded when the expression is parsed.
+// NOTE:
+//
+//	The original sub-expression is kept for the AST functions, e.g. Format and Walk.
+type constExprNode struct {
+	exprBackground
+	val  interface{}
+	orig ExprNode
+}
+
+func (ce *constExprNode) String() string {
+	return ce.orig.String()
+}
+
+func (ce *constExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	return ce.val
+}
+
+// optimize folds the constant sub-expressions, e.g. 1024*1024 or sprintf('%d', 3),
+// compiles the constant patterns of regexp() and matches(), and hashes the constant sets of in().
+func (p *Expr) optimize() error {
+	Rewrite(p.expr, func(node ExprNode) ExprNode {
+		if p.err != nil || node == p.expr {
+			return node
+		}
+		return p.optimizeNode(node)
+	})
+	return p.err
+}
+
+func (p *Expr) optimizeNode(node ExprNode) ExprNode {
+	switch e := node.(type) {
+	case *regexpFuncExprNode:
+		if e.re == nil {
+			v, _ := constValue(e.pattern)
+			s, ok := v.(string)
+			if !ok {
+				p.setErr(p.syntaxErrorAt(posOf(e.pattern), "constant regular expression string"))
+				return node
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				p.setErr(&SyntaxError{Expr: p.src, Offset: posOf(e.pattern), Msg: err.Error()})
+				return node
+			}
+			e.re = re
+		}
+	case *funcExprNode:
+		if e.hashArgs && len(e.args) > 1 {
+			e.set = newConstSet(e.args[1:])
+		}
+		if e.regexpArg > 0 && e.regexpArg <= len(e.args) {
+			arg := e.args[e.regexpArg-1]
+			if v, ok := constValue(arg); ok {
+				if s, ok := v.(string); ok {
+					re, err := regexp.Compile(s)
+					if err != nil {
+						start, _ := spanOf(arg)
+						p.setErr(&SyntaxError{Expr: p.src, Offset: start, Msg: err.Error()})
+						return node
+					}
+					e.re = re
+				}
+			}
+		}
+	}
+	if !isFoldable(node) {
+		return node
+	}
+	v := node.Run(context.Background(), "", nil)
+	if !isConstValue(v) {
+		return node
+	}
+	c := &constExprNode{val: v, orig: node}
+	start, end := spanOf(node)
+	setPos(c, start)
+	setEnd(c, end)
+	return c
+}
+
+// isFoldable returns whether the value of @node only depends on its constant operands.
+func isFoldable(node ExprNode) bool {
+	switch e := node.(type) {
+	case *groupExprNode:
+		return (e.boolOpposite != nil || e.signOpposite != nil) && isConstNode(e.rightOperand)
+	case *andExprNode, *orExprNode:
+		l, ok := constValue(e.LeftOperand())
+		if !ok {
+			return false
+		}
+		_, isAnd := e.(*andExprNode)
+		// short circuit
+		return FakeBool(l) != isAnd || isConstNode(e.RightOperand())
+	case *ternaryExprNode:
+		cond, ok := constValue(e.leftOperand)
+		if !ok || e.rightOperand == nil {
+			return false
+		}
+		if FakeBool(cond) {
+			return isConstNode(e.rightOperand.LeftOperand())
+		}
+		return isConstNode(e.rightOperand.RightOperand())
+	case binaryOperator:
+		return isConstNode(e.LeftOperand()) && isConstNode(e.RightOperand())
+	case *funcExprNode:
+		return e.sig != nil && e.sig.Pure && areConstNodes(e.args)
+	case *sprintfFuncExprNode:
+		return areConstNodes(e.args)
+	case *regexpFuncExprNode:
+		return e.re != nil && isConstNode(e.rightOperand)
+	}
+	return false
+}
+
+// constValue returns the value of the literal or the folded constant.
+func constValue(node ExprNode) (interface{}, bool) {
+	switch e := node.(type) {
+	case *boolExprNode, *stringExprNode, *digitalExprNode, *nilExprNode, *constExprNode:
+		return e.Run(context.Background(), "", nil), true
+	case *groupExprNode:
+		if e.boolOpposite == nil && e.signOpposite == nil && e.rightOperand != nil {
+			return constValue(e.rightOperand)
+		}
+	}
+	return nil, false
+}
+
+func isConstNode(node ExprNode) bool {
+	_, ok := constValue(node)
+	return ok
+}
+
+// areConstNodes returns whether all function arguments are constants, true for f().
+func areConstNodes(args []ExprNode) bool {
+	if countArgs(args) == 0 {
+		return true
+	}
+	for _, arg := range args {
+		if !isConstNode(arg) {
+			return false
+		}
+	}
+	return true
+}
+
+// isConstValue returns whether @v is immutable, which can be shared by the evaluations.
+func isConstValue(v interface{}) bool {
+	switch v.(type) {
+	case nil, bool, string, int64, uint64, float64, time.Time, time.Duration:
+		return true
+	}
+	return false
+}
+
+// spanOf returns the source range of the sub-expression @node.
+func spanOf(node ExprNode) (start, end int) {
+	start, end = posOf(node), endOf(node)
+	if end == 0 {
+		start = -1
+	}
+	for _, child := range childrenOf(node) {
+		s, e := spanOf(child)
+		if e == 0 {
+			continue
+		}
+		if start < 0 || s < start {
+			start = s
+		}
+		if e > end {
+			end = e
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	return
+}
+
+// constSet the hashed constant set of in(),
+// where the equal numbers have the same key.
+type constSet map[interface{}]struct{}
+
+// newConstSet returns nil if any of @args is not constant or can not be hashed.
+func newConstSet(args []ExprNode) constSet {
+	set := make(constSet, len(args))
+	for _, arg := range args {
+		v, ok := constValue(arg)
+		if !ok {
+			return nil
+		}
+		k, ok := setKey(v)
+		if !ok {
+			return nil
+		}
+		set[k] = struct{}{}
+	}
+	return set
+}
+
+// setKey returns the key of nil, bool, string or the number in constSet.
+func setKey(v interface{}) (interface{}, bool) {
+	switch v.(type) {
+	case nil, bool, string:
+		return v, true
+	}
+	n, ok := toNumber(v, false)
+	if !ok {
+		return nil, false
+	}
+	if f, ok := n.(float64); ok && f == math.Trunc(f) {
+		// the same key as the equal integer
+		if f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f), true
+		}
+		if f > 0 && f < math.MaxUint64 {
+			return uint64(f), true
+		}
+	}
+	return n, true
+}
+
+// contains is the same as in(elem, set...).
+func (s constSet) contains(elem interface{}) bool {
+	k, ok := setKey(elem)
+	if !ok {
+		return false
+	}
+	_, ok = s[k]
+	return ok
+}
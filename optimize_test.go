@@ -0,0 +1,120 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptimize(t *testing.T) {
+	vm := New("te")
+	vm.MustRegFuncSig("double", FuncSignature{In: []Kind{NumberKind}, Out: NumberKind, Pure: true}, func(args ...interface{}) interface{} {
+		return args[0].(float64) * 2
+	})
+	vm.MustRegFuncSig("random", FuncSignature{In: []Kind{NumberKind}, Out: NumberKind}, func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	var cases = []struct {
+		src    string
+		consts []string // the source of the folded sub-expressions
+		val    interface{}
+	}{
+		{src: "1024*1024", consts: []string{"1024*1024"}, val: 1048576.0},
+		{src: "x+'a'+'b'"},
+		{src: "x+('a'+'b')", consts: []string{"'a'+'b'"}},
+		{src: "sprintf('%d', 3)+x", consts: []string{"sprintf('%d', 3)"}, val: "3"},
+		{src: "len($)>max(1, 2) && -(1+1)<0", consts: []string{"max(1, 2)", "-(1+1)<0"}},
+		{src: "false && x || 1>0 ? 'a' : x", consts: []string{"false && x || 1>0 ? 'a' : x"}, val: "a"},
+		{src: "true && x", val: false},
+		{src: "$[1+1]", consts: []string{"1+1"}},
+		{src: "double(2)+random(2)", consts: []string{"double(2)"}, val: 6.0},
+		{src: "now()+duration('1s')", consts: []string{"duration('1s')"}},
+		{src: "regexp('^'+'a', 'a'+'b')", consts: []string{"regexp('^'+'a', 'a'+'b')"}, val: true},
+		{src: "in(1, 1.0, 'x')", consts: []string{"in(1, 1.0, 'x')"}, val: true},
+	}
+	for _, c := range cases {
+		p, err := parseExprWithFuncs(c.src, vm.funcs)
+		if !assert.NoError(t, err, c.src) {
+			continue
+		}
+		var consts []string
+		Inspect(p.expr, func(node ExprNode) bool {
+			if e, ok := node.(*constExprNode); ok {
+				consts = append(consts, p.src[e.offset:e.end])
+				assert.Equal(t, KindOf(e.orig), KindOf(e))
+				// the folded operands are not evaluated
+				return false
+			}
+			return true
+		})
+		assert.Equal(t, c.consts, consts, c.src)
+		if c.val != nil {
+			assert.Equal(t, c.val, p.run("", nil), c.src)
+		}
+		// the folded sub-expressions are formatted from the source
+		q, err := parseExprWithFuncs(Format(p.expr), vm.funcs)
+		assert.NoError(t, err, c.src)
+		assert.Equal(t, Format(q.expr), Format(p.expr), c.src)
+	}
+
+	// the rewritten constant is restored
+	p := MustCompile("$+(1+2)")
+	root := Rewrite(p.Root(), func(node ExprNode) ExprNode {
+		if NodeValue(node) == int64(2) {
+			return MustCompile("x").Root()
+		}
+		return node
+	})
+	assert.Equal(t, "$ + (1 + x)", Format(root))
+}
+
+func TestConstSet(t *testing.T) {
+	type S string
+	type I int8
+	var elems = []interface{}{
+		nil, true, false, "a", "1", S("a"), 1, I(1), 1.0, 1.5, int64(2), uint64(math.MaxUint64), float64(math.MaxUint64 / 2),
+		math.NaN(), []int{1},
+	}
+	var sets = []string{
+		"'a', 1, nil",
+		"1.0, true",
+		"2.0, 'b', 1.5",
+		"18446744073709551615, 9223372036854775807",
+		"9223372036854775808.0, -0.0",
+	}
+	for _, set := range sets {
+		p := MustCompile("in(x, " + set + ")")
+		f := p.expr.expr.RightOperand().(*funcExprNode)
+		assert.NotNil(t, f.set, set)
+		fn := p.expr.fn
+		for _, elem := range elems {
+			env := map[string]interface{}{"x": elem}
+			r, err := p.EvalWithEnv(nil, env)
+			assert.NoError(t, err)
+			// compare with the linear search of the expression tree
+			p.expr.fn = nil
+			want, err := p.EvalWithEnv(nil, env)
+			assert.NoError(t, err)
+			p.expr.fn = fn
+			assert.Equal(t, want, r, "in(%#v, %s)", elem, set)
+		}
+	}
+	// the set with the variable is not hashed
+	f := MustCompile("in($, 'a', x)").expr.expr.RightOperand().(*funcExprNode)
+	assert.Nil(t, f.set)
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/andeya/ameda"
+)
+
+// Program a standalone compiled expression,
+// which can be evaluated without a struct tag.
+type Program struct {
+	src  string
+	expr *Expr
+}
+
+// programVM is used to access the fields of the struct evaluated by Program.
+// NOTE:
+//
+//	No tag name, so the struct tags are never interpreted.
+var programVM = New()
+
+// Compile parses the expression @src into a Program.
+// NOTE:
+//
+//	The syntax is the same as the struct tag expression.
+func Compile(src string) (*Program, error) {
+	expr, err := parseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	expr.compile(nil, "")
+	return &Program{src: src, expr: expr}, nil
+}
+
+// MustCompile is similar to Compile, but panic when error.
+func MustCompile(src string) *Program {
+	p, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source expression.
+func (p *Program) String() string {
+	return p.src
+}
+
+// Root returns the copy of the expression tree, or nil if the expression is empty.
+// NOTE:
+//
+//	Use Walk, Inspect, Rewrite and Format to work with the tree;
+//	The copy can be rewritten without changing the program.
+func (p *Program) Root() ExprNode {
+	root := cloneNode(p.expr.expr.RightOperand())
+	if root != nil {
+		root.SetParent(nil)
+	}
+	return root
+}
+
+// Eval evaluates the program against @v.
+// NOTE:
+//
+//	@v can be a struct, struct pointer, map with string keys, or nil;
+//	(X.Y)$ selects the field or map value X.Y of @v, $ selects @v itself;
+//	result types: int64, uint64, float64, string, bool, time.Time, time.Duration, nil,
+//	and the integer result keeps its precision, e.g. 9007199254740993 is int64;
+//	the number error, e.g. integer overflow, is returned as the error.
+func (p *Program) Eval(v interface{}) (interface{}, error) {
+	return p.EvalWithEnv(v, nil)
+}
+
+// EvalWithEnv evaluates the program against @v with the given env.
+// NOTE:
+//
+//	@v can be a struct, struct pointer, map with string keys, or nil;
+//	result types: the same as Eval;
+//	the number error, e.g. integer overflow, is returned as the error.
+func (p *Program) EvalWithEnv(v interface{}, env map[string]interface{}) (interface{}, error) {
+	te, err := newProgramTagExpr(v)
+	if err != nil {
+		return nil, err
+	}
+	return evalResult(p.expr.evaluate(context.Background(), "", te, env))
+}
+
+// evalResult returns the number error of the result @r, e.g. integer overflow, as the error.
+func evalResult(r interface{}) (interface{}, error) {
+	if err := numberErrorOf(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func newProgramTagExpr(v interface{}) (*TagExpr, error) {
+	rv, isReflectValue := v.(reflect.Value)
+	if !isReflectValue {
+		rv = reflect.ValueOf(v)
+	}
+	rv = ameda.DereferenceValue(ameda.DereferenceInterfaceValue(rv))
+	if !rv.IsValid() {
+		return &TagExpr{}, nil
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		return programVM.Run(rv)
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		return &TagExpr{data: rv}, nil
+	}
+	return nil, fmt.Errorf("unsupport data: %s", rv.Type().String())
+}
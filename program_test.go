@@ -0,0 +1,77 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bytedance/go-tagexpr/v2"
+)
+
+func TestProgram(t *testing.T) {
+	type Sub struct {
+		Name string
+	}
+	type T struct {
+		A   int
+		b   string
+		Sub *Sub
+		S   []string
+	}
+	obj := &T{A: 5, b: "x", Sub: &Sub{Name: "sub"}, S: []string{"s0"}}
+
+	var cases = []struct {
+		src  string
+		data interface{}
+		env  map[string]interface{}
+		val  interface{}
+	}{
+		{src: "(A)$>1 && (b)$=='x'", data: obj, val: true},
+		{src: "(Sub.Name)$+(S)$[0]", data: obj, val: "subs0"},
+		{src: "$['A']", data: obj, val: int64(5)},
+		{src: "len((S)$)", data: *obj, val: 1.0},
+		{src: "(a.b)$+1", data: map[string]interface{}{"a": map[string]int{"b": 1}}, val: int64(2)},
+		{src: "(a)$[1]", data: map[string]interface{}{"a": []string{"x", "y"}}, val: "y"},
+		{src: "(missing)$==nil", data: map[string]interface{}{}, val: true},
+		{src: "$==nil", data: nil, val: true},
+		{src: "minVal<(A)$", data: obj, env: map[string]interface{}{"minVal": 3}, val: true},
+		{src: "minVal+1", data: nil, env: map[string]interface{}{"minVal": 3}, val: int64(4)},
+		{src: "9007199254740993", data: nil, val: int64(9007199254740993)},
+		{src: "$['ID']+1", data: map[string]uint64{"ID": 1<<63 + 1}, val: uint64(1<<63 + 2)},
+		{src: "(A)$/2", data: obj, val: 2.5},
+	}
+	for _, c := range cases {
+		p, err := tagexpr.Compile(c.src)
+		if !assert.NoError(t, err, c.src) {
+			continue
+		}
+		assert.Equal(t, c.src, p.String())
+		var val interface{}
+		if c.env != nil {
+			val, err = p.EvalWithEnv(c.data, c.env)
+		} else {
+			val, err = p.Eval(c.data)
+		}
+		assert.NoError(t, err, c.src)
+		assert.Equal(t, c.val, val, c.src)
+	}
+
+	_, err := tagexpr.MustCompile("$").Eval(1)
+	assert.EqualError(t, err, "unsupport data: int")
+	_, err = tagexpr.Compile("($")
+	assert.Error(t, err)
+}
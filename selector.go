@@ -13,6 +13,10 @@ const (
 	ExprNameSeparator = "@"
 	// DefaultExprName the default name of single model expression
 	DefaultExprName = ExprNameSeparator
+	// PriorityName the directive in the struct tag, which sets the integer priority of the field expressions,
+	// e.g. `vd:"#priority:1;$>0"`, and TagExpr.Range ranges the expressions with higher priority first;
+	// it is not a valid expression name, so the expressions named priority are kept
+	PriorityName = "#priority"
 )
 
 // FieldSelector expression selector
@@ -0,0 +1,195 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --------------------------- Function signature ---------------------------
+
+// Kind the kind set of the expression value, used by the function signature.
+// NOTE:
+//
+//	The kinds can be combined, e.g. StringKind|ListKind;
+//	AnyKind(0) matches all kinds.
+type Kind uint16
+
+// AnyKind matches all kinds.
+const AnyKind Kind = 0
+
+// The kinds of the expression value.
+const (
+	NumberKind Kind = 1 << iota
+	StringKind
+	BoolKind
+	TimeKind
+	DurationKind
+	ListKind
+	MapKind
+	StructKind
+)
+
+var kindNames = []string{"number", "string", "bool", "time", "duration", "list", "map", "struct"}
+
+// String returns the kind names joined by '|', e.g. string|list.
+func (k Kind) String() string {
+	if k == AnyKind {
+		return "any"
+	}
+	var a []string
+	for i, name := range kindNames {
+		if k&(1<<uint(i)) != 0 {
+			a = append(a, name)
+		}
+	}
+	return strings.Join(a, "|")
+}
+
+// accepts returns whether the value of kind @actual can be used as kind @k.
+func (k Kind) accepts(actual Kind) bool {
+	return k == AnyKind || actual == AnyKind || k&actual != 0
+}
+
+// FuncSignature the signature of the function expression,
+// which is checked when the struct tag is parsed.
+type FuncSignature struct {
+	// In the kinds of the arguments
+	In []Kind
+	// Optional the number of the trailing arguments in In that can be omitted
+	Optional int
+	// Variadic the last argument in In can be repeated or omitted
+	Variadic bool
+	// Out the kind of the result
+	Out Kind
+	// Loose the mismatched argument kinds are only reported by VM.Check,
+	// instead of rejected when the struct tag is parsed
+	Loose bool
+	// Pure the result only depends on the arguments,
+	// so the function is called when the expression is parsed if all arguments are constants
+	Pure bool
+	// Integer the integer arguments are passed as int64 or uint64 without precision loss,
+	// instead of converted to float64
+	Integer bool
+}
+
+// arity returns the minimum and maximum numbers of the arguments, max<0 means unlimited.
+func (sig *FuncSignature) arity() (min, max int) {
+	min = len(sig.In) - sig.Optional
+	max = len(sig.In)
+	if sig.Variadic {
+		if sig.Optional == 0 && min > 0 {
+			min--
+		}
+		max = -1
+	}
+	if min < 0 {
+		min = 0
+	}
+	return
+}
+
+// checkArity returns the error message if the function @funcName can not be called with @n arguments.
+func (sig *FuncSignature) checkArity(funcName string, n int) string {
+	min, max := sig.arity()
+	if n >= min && (max < 0 || n <= max) {
+		return ""
+	}
+	var expects string
+	switch {
+	case min == max:
+		expects = pluralArgs(min)
+	case max < 0:
+		expects = "at least " + pluralArgs(min)
+	default:
+		expects = fmt.Sprintf("%d to %d arguments", min, max)
+	}
+	return fmt.Sprintf("%s() expects %s, got %d", funcName, expects, n)
+}
+
+func pluralArgs(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// argKind returns the declared kind of the @i-th argument.
+func (sig *FuncSignature) argKind(i int) Kind {
+	if i < len(sig.In) {
+		return sig.In[i]
+	}
+	if sig.Variadic && len(sig.In) > 0 {
+		return sig.In[len(sig.In)-1]
+	}
+	return AnyKind
+}
+
+// countArgs returns the number of the function arguments, where f() has no argument.
+func countArgs(args []ExprNode) int {
+	if len(args) == 1 && args[0].RightOperand() == nil {
+		return 0
+	}
+	return len(args)
+}
+
+// MustRegFuncSig registers function expression with the signature.
+// NOTE:
+//
+//	The same as RegFuncSig, but panic if there is an error.
+func MustRegFuncSig(funcName string, sig FuncSignature, fn func(...interface{}) interface{}, force ...bool) {
+	err := RegFuncSig(funcName, sig, fn, force...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegFuncSig registers function expression with the signature.
+// NOTE:
+//
+//	The number of arguments is checked when the expression is parsed,
+//	and the kinds of arguments are checked when the struct tag is parsed,
+//	e.g. lower(5) is rejected since lower expects string;
+//	If @force=true, allow to cover the existed same @funcName;
+//	The go number types always are float64, unless sig.Integer=true;
+//	The go string types always are string.
+func RegFuncSig(funcName string, sig FuncSignature, fn func(...interface{}) interface{}, force ...bool) error {
+	return regFunc(funcName, newFuncSig(funcName, sig, fn), force...)
+}
+
+// MustRegFuncSig registers function expression with the signature only for the VM.
+// NOTE:
+//
+//	The same as VM.RegFuncSig, but panic if there is an error.
+func (vm *VM) MustRegFuncSig(funcName string, sig FuncSignature, fn func(...interface{}) interface{}, force ...bool) {
+	err := vm.RegFuncSig(funcName, sig, fn, force...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegFuncSig registers function expression with the signature only for the VM.
+// NOTE:
+//
+//	The same as the global RegFuncSig, but the function shadows the global one with the same @funcName.
+func (vm *VM) RegFuncSig(funcName string, sig FuncSignature, fn func(...interface{}) interface{}, force ...bool) error {
+	return vm.regFunc(funcName, newFuncSig(funcName, sig, fn), force...)
+}
+
+// newFuncSig creates the function expression reader with the signature.
+func newFuncSig(funcName string, sig FuncSignature, fn func(...interface{}) interface{}) func(*Expr, *string) ExprNode {
+	return newFuncReader(funcName, funcExprNode{fn: fn, rawNumber: sig.Integer, sig: &sig})
+}
@@ -17,8 +17,10 @@ package tagexpr
 import (
 	"context"
 	"fmt"
+	"math"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/andeya/goutil/errors"
@@ -28,6 +30,20 @@ import (
 
 var funcList = map[string]func(p *Expr, expr *string) ExprNode{}
 
+// builtinFuncList the builtin functions with the generic names, e.g. max and join,
+// which are shadowed by the registered functions with the same name without the force flag.
+var builtinFuncList = map[string]func(p *Expr, expr *string) ExprNode{}
+
+// regBuiltinFunc registers the builtin function expression reader, see builtinFuncList.
+func regBuiltinFunc(funcName string, reader func(p *Expr, expr *string) ExprNode) {
+	builtinFuncList[funcName] = reader
+}
+
+// regBuiltinFuncSig registers the builtin function with the signature, see builtinFuncList.
+func regBuiltinFuncSig(funcName string, sig FuncSignature, fn func(...interface{}) interface{}) {
+	regBuiltinFunc(funcName, newFuncSig(funcName, sig, fn))
+}
+
 // MustRegFunc registers function expression.
 // NOTE:
 //
@@ -51,13 +67,99 @@ func MustRegFunc(funcName string, fn func(...interface{}) interface{}, force ...
 //	The go number types always are float64;
 //	The go string types always are string.
 func RegFunc(funcName string, fn func(...interface{}) interface{}, force ...bool) error {
+	return regFunc(funcName, newFunc(funcName, fn, false), force...)
+}
+
+// MustRegFuncCtx registers function expression with the context.
+// NOTE:
+//
+//	The same as RegFuncCtx, but panic if there is an error.
+func MustRegFuncCtx(funcName string, fn func(ctx context.Context, args ...interface{}) (interface{}, error), force ...bool) {
+	err := RegFuncCtx(funcName, fn, force...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegFuncCtx registers function expression with the context.
+// NOTE:
+//
+//	@ctx is the one passed to TagExpr.EvalContext or Validator.ValidateContext,
+//	or context.Background() for the other entry points;
+//	If @fn returns an error, the expression value is the error;
+//	If @force=true, allow to cover the existed same @funcName;
+//	The go number types always are float64;
+//	The go string types always are string.
+func RegFuncCtx(funcName string, fn func(ctx context.Context, args ...interface{}) (interface{}, error), force ...bool) error {
+	return regFunc(funcName, newFuncCtx(funcName, fn), force...)
+}
+
+func regFunc(funcName string, reader func(*Expr, *string) ExprNode, force ...bool) error {
 	if len(force) == 0 || !force[0] {
 		_, ok := funcList[funcName]
 		if ok {
 			return errors.Errorf("duplicate registration expression function: %s", funcName)
 		}
 	}
-	funcList[funcName] = newFunc(funcName, fn)
+	funcList[funcName] = reader
+	return nil
+}
+
+// MustRegFunc registers function expression only for the VM.
+// NOTE:
+//
+//	The same as the global MustRegFunc, but the function shadows the global one with the same @funcName;
+//	Panic if there is an error.
+func (vm *VM) MustRegFunc(funcName string, fn func(...interface{}) interface{}, force ...bool) {
+	err := vm.RegFunc(funcName, fn, force...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegFunc registers function expression only for the VM.
+// NOTE:
+//
+//	The VM inherits the global functions, and the function shadows the global one with the same @funcName;
+//	If @force=true, allow to cover the existed same @funcName registered by the VM;
+//	The function is resolved when the struct tag is parsed,
+//	so it should be registered before the struct is run or warmed up.
+func (vm *VM) RegFunc(funcName string, fn func(...interface{}) interface{}, force ...bool) error {
+	return vm.regFunc(funcName, newFunc(funcName, fn, false), force...)
+}
+
+// MustRegFuncCtx registers function expression with the context only for the VM.
+// NOTE:
+//
+//	The same as VM.RegFuncCtx, but panic if there is an error.
+func (vm *VM) MustRegFuncCtx(funcName string, fn func(ctx context.Context, args ...interface{}) (interface{}, error), force ...bool) {
+	err := vm.RegFuncCtx(funcName, fn, force...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegFuncCtx registers function expression with the context only for the VM.
+// NOTE:
+//
+//	The same as the global RegFuncCtx, but the function shadows the global one with the same @funcName.
+func (vm *VM) RegFuncCtx(funcName string, fn func(ctx context.Context, args ...interface{}) (interface{}, error), force ...bool) error {
+	return vm.regFunc(funcName, newFuncCtx(funcName, fn), force...)
+}
+
+func (vm *VM) regFunc(funcName string, reader func(*Expr, *string) ExprNode, force ...bool) error {
+	vm.rw.Lock()
+	defer vm.rw.Unlock()
+	if len(force) == 0 || !force[0] {
+		_, ok := vm.funcs[funcName]
+		if ok {
+			return errors.Errorf("duplicate registration expression function: %s", funcName)
+		}
+	}
+	if vm.funcs == nil {
+		vm.funcs = make(map[string]func(p *Expr, expr *string) ExprNode)
+	}
+	vm.funcs[funcName] = reader
 	return nil
 }
 
@@ -72,24 +174,29 @@ func (p *Expr) parseFuncSign(funcName string, expr *string) (boolOpposite *bool,
 	lastStr := *expr
 	subExprNode := readPairedSymbol(expr, '(', ')')
 	if subExprNode == nil {
+		p.setErr(p.syntaxErrorAt(p.offsetOf(lastStr)+len(lastStr), "')'"))
 		return
 	}
-	*subExprNode = "," + *subExprNode
-	for {
-		if strings.HasPrefix(*subExprNode, ",") {
-			*subExprNode = (*subExprNode)[1:]
-			operand := newGroupExprNode()
-			err := p.parseExprNode(trimLeftSpace(subExprNode), operand)
-			if err != nil {
+	defer p.window(p.offsetOf(*expr) - 1)()
+	for i := 0; ; i++ {
+		// the arguments are parsed in place, so that their positions can be located
+		if i > 0 {
+			if !strings.HasPrefix(*subExprNode, ",") {
+				p.setErr(p.syntaxError(*subExprNode, "operator, ',' or ')'"))
 				*expr = lastStr
 				return
 			}
-			sortPriority(operand)
-			args = append(args, operand)
-		} else {
+			*subExprNode = (*subExprNode)[1:]
+		}
+		operand := newGroupExprNode()
+		err := p.parseExprNode(trimLeftSpace(subExprNode), operand)
+		if err != nil {
+			p.setErr(err)
 			*expr = lastStr
 			return
 		}
+		sortPriority(operand)
+		args = append(args, operand)
 		trimLeftSpace(subExprNode)
 		if len(*subExprNode) == 0 {
 			found = true
@@ -98,27 +205,55 @@ func (p *Expr) parseFuncSign(funcName string, expr *string) (boolOpposite *bool,
 	}
 }
 
-func newFunc(funcName string, fn func(...interface{}) interface{}) func(*Expr, *string) ExprNode {
+// newFunc creates the function expression reader.
+// NOTE:
+//
+//	If @rawNumber=false, the number arguments are converted to float64.
+func newFunc(funcName string, fn func(...interface{}) interface{}, rawNumber bool) func(*Expr, *string) ExprNode {
+	return newFuncReader(funcName, funcExprNode{fn: fn, rawNumber: rawNumber})
+}
+
+// newFuncCtx creates the function expression reader with the context.
+func newFuncCtx(funcName string, fn func(context.Context, ...interface{}) (interface{}, error)) func(*Expr, *string) ExprNode {
+	return newFuncReader(funcName, funcExprNode{fnCtx: fn})
+}
+
+func newFuncReader(funcName string, tmpl funcExprNode) func(*Expr, *string) ExprNode {
 	return func(p *Expr, expr *string) ExprNode {
+		last := *expr
 		boolOpposite, signOpposite, args, found := p.parseFuncSign(funcName, expr)
 		if !found {
 			return nil
 		}
-		return &funcExprNode{
-			fn:           fn,
-			boolOpposite: boolOpposite,
-			signOpposite: signOpposite,
-			args:         args,
+		if tmpl.sig != nil {
+			if msg := tmpl.sig.checkArity(funcName, countArgs(args)); msg != "" {
+				p.setErr(&SyntaxError{Expr: p.src, Offset: p.offsetOf(last), Msg: msg})
+				return nil
+			}
 		}
+		e := tmpl
+		e.name = funcName
+		e.boolOpposite = boolOpposite
+		e.signOpposite = signOpposite
+		e.args = args
+		return &e
 	}
 }
 
 type funcExprNode struct {
 	exprBackground
+	name         string
 	args         []ExprNode
 	fn           func(...interface{}) interface{}
+	fnCtx        func(context.Context, ...interface{}) (interface{}, error)
+	sig          *FuncSignature
 	boolOpposite *bool
 	signOpposite *bool
+	rawNumber    bool
+	hashArgs     bool           // the constant arguments except the first one can be hashed, i.e. in()
+	set          constSet       // the hashed constant arguments, set by optimize if hashArgs
+	regexpArg    int            // the 1-based index of the regular expression argument, i.e. matches()
+	re           *regexp.Regexp // the constant regular expression, compiled by optimize if regexpArg>0
 }
 
 func (f *funcExprNode) String() string {
@@ -133,16 +268,52 @@ func (f *funcExprNode) Run(ctx context.Context, currField string, tagExpr *TagEx
 			args[k] = v.Run(ctx, currField, tagExpr)
 		}
 	}
+	return f.call(ctx, args)
+}
+
+// call calls the function with the argument values.
+func (f *funcExprNode) call(ctx context.Context, args []interface{}) interface{} {
+	if err := numberErrorOf(args...); err != nil {
+		return err
+	}
+	if f.re != nil {
+		args[f.regexpArg-1] = f.re
+	}
+	if !f.rawNumber {
+		for k, v := range args {
+			args[k] = normalizeNumber(v)
+		}
+	}
+	if f.fnCtx != nil {
+		r, err := f.fnCtx(ctx, args...)
+		if err != nil {
+			return err
+		}
+		return realValue(r, f.boolOpposite, f.signOpposite)
+	}
 	return realValue(f.fn(args...), f.boolOpposite, f.signOpposite)
 }
 
 // --------------------------- Built-in function ---------------------------
+
+var (
+	// lenSig the signature of len and mblen, which return 0 for the values without length
+	lenSig = FuncSignature{In: []Kind{StringKind | ListKind | MapKind}, Out: NumberKind, Loose: true, Pure: true}
+	// number1Sig the signature of the function with one number argument
+	number1Sig = FuncSignature{In: []Kind{NumberKind}, Out: NumberKind, Pure: true}
+	// numbersSig the signature of the function with one or more number arguments
+	numbersSig = FuncSignature{In: []Kind{NumberKind, NumberKind}, Variadic: true, Out: NumberKind, Pure: true, Integer: true}
+)
+
 func init() {
 	funcList["regexp"] = readRegexpFuncExprNode
 	funcList["sprintf"] = readSprintfFuncExprNode
 	funcList["range"] = readRangeFuncExprNode
+	for _, name := range []string{"all", "any", "none", "count", "filter", "map", "unique"} {
+		regBuiltinFunc(name, newCollectionFunc(name))
+	}
 	// len: Built-in function len, the length of struct field X
-	MustRegFunc("len", func(args ...interface{}) (n interface{}) {
+	MustRegFuncSig("len", lenSig, func(args ...interface{}) (n interface{}) {
 		if len(args) != 1 {
 			return 0
 		}
@@ -161,7 +332,7 @@ func init() {
 		return float64(reflect.ValueOf(v).Len())
 	}, true)
 	// mblen: get the length of string field X (character number)
-	MustRegFunc("mblen", func(args ...interface{}) (n interface{}) {
+	MustRegFuncSig("mblen", lenSig, func(args ...interface{}) (n interface{}) {
 		if len(args) != 1 {
 			return 0
 		}
@@ -180,29 +351,153 @@ func init() {
 		return float64(reflect.ValueOf(v).Len())
 	}, true)
 
-	// in: Check if the first parameter is one of the enumerated parameters
-	MustRegFunc("in", func(args ...interface{}) interface{} {
-		switch len(args) {
-		case 0:
-			return true
-		case 1:
+	// in: Check if the first parameter is one of the enumerated parameters or the elements of the only list,
+	// e.g. in($, (Items)$[*].Name), and the constant enumerated parameters are hashed
+	funcList["in"] = newFuncReader("in", funcExprNode{
+		fn:        inFunc,
+		sig:       &FuncSignature{In: []Kind{AnyKind, AnyKind}, Variadic: true, Out: BoolKind, Pure: true},
+		rawNumber: true,
+		hashArgs:  true,
+	})
+	// abs: the absolute value of the number
+	regBuiltinFuncSig("abs", FuncSignature{In: []Kind{NumberKind}, Out: NumberKind, Pure: true, Integer: true}, func(args ...interface{}) interface{} {
+		if len(args) != 1 {
+			return nil
+		}
+		n, ok := toNumber(args[0], false)
+		if !ok {
+			return nil
+		}
+		return absNumber(n)
+	})
+	// min: the smallest of the numbers, e.g. min($, 10) or min(1, 2, 3)
+	regBuiltinFuncSig("min", numbersSig, func(args ...interface{}) interface{} {
+		return extremeNumber(args, -1)
+	})
+	// max: the largest of the numbers, e.g. max($, 10) or max(1, 2, 3)
+	regBuiltinFuncSig("max", numbersSig, func(args ...interface{}) interface{} {
+		return extremeNumber(args, 1)
+	})
+	// clamp: the number limited to the range [lo, hi], e.g. clamp($, 0, 100)
+	regBuiltinFuncSig("clamp", FuncSignature{In: []Kind{NumberKind, NumberKind, NumberKind}, Out: NumberKind, Pure: true, Integer: true}, func(args ...interface{}) interface{} {
+		if len(args) != 3 {
+			return nil
+		}
+		return extremeNumber([]interface{}{extremeNumber(args[:2], 1), args[2]}, -1)
+	})
+	// floor: the greatest integer value less than or equal to the number
+	regBuiltinFuncSig("floor", number1Sig, mathFunc1(math.Floor))
+	// ceil: the least integer value greater than or equal to the number
+	regBuiltinFuncSig("ceil", number1Sig, mathFunc1(math.Ceil))
+	// sqrt: the square root of the number
+	regBuiltinFuncSig("sqrt", number1Sig, mathFunc1(math.Sqrt))
+	// round: the number rounded to n (0 if omitted) decimal places, half away from zero, e.g. round($, 2)
+	regBuiltinFuncSig("round", FuncSignature{In: []Kind{NumberKind, NumberKind}, Optional: 1, Out: NumberKind, Pure: true}, func(args ...interface{}) interface{} {
+		if len(args) == 1 {
+			return mathFunc1(math.Round)(args...)
+		}
+		if len(args) != 2 {
+			return nil
+		}
+		x, ok0 := toFloat64(args[0], false)
+		n, ok1 := toFloat64(args[1], false)
+		if !ok0 || !ok1 {
+			return nil
+		}
+		p := math.Pow10(int(n))
+		return Number(math.Round(x*p) / p)
+	})
+	// pow: x**y, the base x raised to the exponent y
+	regBuiltinFuncSig("pow", FuncSignature{In: []Kind{NumberKind, NumberKind}, Out: NumberKind, Pure: true}, func(args ...interface{}) interface{} {
+		if len(args) != 2 {
+			return nil
+		}
+		x, ok0 := toFloat64(args[0], false)
+		y, ok1 := toFloat64(args[1], false)
+		if !ok0 || !ok1 {
+			return nil
+		}
+		return Number(math.Pow(x, y))
+	})
+	// isNaN: whether the value is NaN, e.g. isNaN((A)$/(B)$)
+	regBuiltinFuncSig("isNaN", FuncSignature{In: []Kind{NumberKind}, Out: BoolKind, Pure: true}, func(args ...interface{}) interface{} {
+		if len(args) != 1 {
+			return false
+		}
+		f, ok := args[0].(float64)
+		return Boolean(ok && math.IsNaN(f))
+	})
+	// isInf: whether the value is an infinity, according to the sign (0 if omitted): >0 +Inf, <0 -Inf, 0 either
+	regBuiltinFuncSig("isInf", FuncSignature{In: []Kind{NumberKind, NumberKind}, Optional: 1, Out: BoolKind, Pure: true}, func(args ...interface{}) interface{} {
+		if len(args) != 1 && len(args) != 2 {
 			return false
-		default:
-			elem := args[0]
-			set := args[1:]
-			for _, e := range set {
-				if elem == e {
-					return true
+		}
+		f, ok := args[0].(float64)
+		if !ok {
+			return false
+		}
+		var sign float64
+		if len(args) == 2 {
+			sign, _ = toFloat64(args[1], false)
+		}
+		return Boolean(math.IsInf(f, int(sign)))
+	})
+}
+
+// inFunc checks if the first parameter is one of the enumerated parameters,
+// or the elements of the array or slice if it is the only one.
+func inFunc(args ...interface{}) interface{} {
+	switch len(args) {
+	case 0:
+		return true
+	case 1:
+		return false
+	default:
+		elem := args[0]
+		set := args[1:]
+		if len(set) == 1 {
+			if v := reflect.ValueOf(set[0]); v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+				set = make([]interface{}, v.Len())
+				for i := range set {
+					set[i] = rangeElemValue(v.Index(i))
 				}
 			}
-			return false
 		}
-	}, true)
+		n0, isNum := toNumber(elem, false)
+		for _, e := range set {
+			if equalValue(elem, e) {
+				return true
+			}
+			if isNum {
+				if n1, ok := toNumber(e, false); ok {
+					if c, ok := compareNumber(n0, n1); ok && c == 0 {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+}
+
+// mathFunc1 creates the function of one float64 argument.
+func mathFunc1(fn func(float64) float64) func(...interface{}) interface{} {
+	return func(args ...interface{}) interface{} {
+		if len(args) != 1 {
+			return nil
+		}
+		x, ok := toFloat64(args[0], false)
+		if !ok {
+			return nil
+		}
+		return Number(fn(x))
+	}
 }
 
 type regexpFuncExprNode struct {
 	exprBackground
 	re           *regexp.Regexp
+	pattern      ExprNode // the constant pattern expression, e.g. '^'+'\\d', which is compiled by optimize
 	boolOpposite bool
 }
 
@@ -219,17 +514,38 @@ func readRegexpFuncExprNode(p *Expr, expr *string) ExprNode {
 	lastStr := *expr
 	subExprNode := readPairedSymbol(expr, '(', ')')
 	if subExprNode == nil {
+		p.setErr(p.syntaxErrorAt(p.offsetOf(lastStr)+len(lastStr), "')'"))
 		return nil
 	}
-	s := readPairedSymbol(trimLeftSpace(subExprNode), '\'', '\'')
-	if s == nil {
-		*expr = lastStr
-		return nil
-	}
-	rege, err := regexp.Compile(*s)
-	if err != nil {
-		*expr = lastStr
-		return nil
+	defer p.window(p.offsetOf(*expr) - 1)()
+	var (
+		rege    *regexp.Regexp
+		pattern ExprNode
+		err     error
+	)
+	rest := *trimLeftSpace(subExprNode)
+	if s := readQuotedString(subExprNode); s != nil &&
+		(*trimLeftSpace(subExprNode) == "" || strings.HasPrefix(*subExprNode, ",")) {
+		rege, err = regexp.Compile(*s)
+		if err != nil {
+			p.setErr(&SyntaxError{Expr: p.src, Offset: p.offsetOf(rest) + 1, Msg: err.Error()})
+			*expr = lastStr
+			return nil
+		}
+	} else {
+		*subExprNode = rest
+		pattern = newGroupExprNode()
+		err = p.parseExprNode(subExprNode, pattern)
+		if err == nil && pattern.RightOperand() == nil {
+			err = p.syntaxError(rest, "regular expression string")
+		}
+		if err != nil {
+			p.setErr(err)
+			*expr = lastStr
+			return nil
+		}
+		sortPriority(pattern)
+		setPos(pattern, p.offsetOf(rest))
 	}
 	operand := newGroupExprNode()
 	trimLeftSpace(subExprNode)
@@ -237,6 +553,7 @@ func readRegexpFuncExprNode(p *Expr, expr *string) ExprNode {
 		*subExprNode = (*subExprNode)[1:]
 		err = p.parseExprNode(trimLeftSpace(subExprNode), operand)
 		if err != nil {
+			p.setErr(err)
 			*expr = lastStr
 			return nil
 		}
@@ -246,21 +563,30 @@ func readRegexpFuncExprNode(p *Expr, expr *string) ExprNode {
 	}
 	trimLeftSpace(subExprNode)
 	if *subExprNode != "" {
+		p.setErr(p.syntaxError(*subExprNode, "operator or ')'"))
 		*expr = lastStr
 		return nil
 	}
 	e := &regexpFuncExprNode{
-		re: rege,
+		re:      rege,
+		pattern: pattern,
 	}
 	if boolOpposite != nil {
 		e.boolOpposite = *boolOpposite
 	}
+	if pattern != nil {
+		pattern.SetParent(e)
+	}
 	e.SetRightOperand(operand)
 	return e
 }
 
 func (re *regexpFuncExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	param := re.rightOperand.Run(ctx, currField, tagExpr)
+	return re.match(re.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+// match returns whether @param matches the regular expression.
+func (re *regexpFuncExprNode) match(param interface{}) interface{} {
 	switch v := param.(type) {
 	case string:
 		bol := re.re.MatchString(v)
@@ -285,6 +611,7 @@ func (re *regexpFuncExprNode) Run(ctx context.Context, currField string, tagExpr
 type sprintfFuncExprNode struct {
 	exprBackground
 	format string
+	verbs  []byte // the verbs of the arguments in the format
 	args   []ExprNode
 }
 
@@ -300,15 +627,19 @@ func readSprintfFuncExprNode(p *Expr, expr *string) ExprNode {
 	lastStr := *expr
 	subExprNode := readPairedSymbol(expr, '(', ')')
 	if subExprNode == nil {
+		p.setErr(p.syntaxErrorAt(p.offsetOf(lastStr)+len(lastStr), "')'"))
 		return nil
 	}
-	format := readPairedSymbol(trimLeftSpace(subExprNode), '\'', '\'')
+	defer p.window(p.offsetOf(*expr) - 1)()
+	format := readQuotedString(trimLeftSpace(subExprNode))
 	if format == nil {
+		p.setErr(p.syntaxError(*subExprNode, "format string"))
 		*expr = lastStr
 		return nil
 	}
 	e := &sprintfFuncExprNode{
 		format: *format,
+		verbs:  sprintfVerbs(*format),
 	}
 	for {
 		trimLeftSpace(subExprNode)
@@ -320,12 +651,14 @@ func readSprintfFuncExprNode(p *Expr, expr *string) ExprNode {
 			operand := newGroupExprNode()
 			err := p.parseExprNode(trimLeftSpace(subExprNode), operand)
 			if err != nil {
+				p.setErr(err)
 				*expr = lastStr
 				return nil
 			}
 			sortPriority(operand)
 			e.args = append(e.args, operand)
 		} else {
+			p.setErr(p.syntaxError(*subExprNode, "operator, ',' or ')'"))
 			*expr = lastStr
 			return nil
 		}
@@ -340,5 +673,78 @@ func (se *sprintfFuncExprNode) Run(ctx context.Context, currField string, tagExp
 			args[i] = e.Run(ctx, currField, tagExpr)
 		}
 	}
+	return se.sprintf(args)
+}
+
+// sprintf formats the argument values @args,
+// whose numbers are converted for their verbs, e.g. sprintf('%d', 3) and sprintf('%.2f', 5).
+func (se *sprintfFuncExprNode) sprintf(args []interface{}) interface{} {
+	if err := numberErrorOf(args...); err != nil {
+		return err
+	}
+	for k, v := range args {
+		var verb byte
+		if k < len(se.verbs) {
+			verb = se.verbs[k]
+		}
+		args[k] = sprintfArg(verb, v)
+	}
 	return fmt.Sprintf(se.format, args...)
 }
+
+// sprintfArg converts the number @v for the verb @verb:
+// the integer verbs get int64 if the float64 is an integer, the float verbs get float64,
+// and the others get the number as it is, e.g. int64 for %v.
+func sprintfArg(verb byte, v interface{}) interface{} {
+	switch verb {
+	case 'b', 'c', 'd', 'o', 'O', 'q', 'x', 'X', 'U':
+		if f, ok := v.(float64); ok && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f)
+		}
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		return normalizeNumber(v)
+	}
+	return v
+}
+
+// sprintfVerbs returns the verbs of the arguments in the format @format, e.g. d of %d,
+// following the explicit argument indexes, and the width or precision * gets d.
+func sprintfVerbs(format string) []byte {
+	var verbs []byte
+	var argNum int
+	set := func(verb byte) {
+		for len(verbs) <= argNum {
+			verbs = append(verbs, 0)
+		}
+		verbs[argNum] = verb
+		argNum++
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+	verb:
+		for i++; i < len(format); i++ {
+			switch c := format[i]; {
+			case c == '[':
+				j := strings.IndexByte(format[i:], ']')
+				if j < 0 {
+					return verbs
+				}
+				if n, err := strconv.Atoi(format[i+1 : i+j]); err == nil && n > 0 {
+					argNum = n - 1
+				}
+				i += j
+			case c == '*':
+				set('d')
+			case strings.IndexByte("+-# .0123456789", c) >= 0:
+			case c == '%':
+				break verb
+			default:
+				set(c)
+				break verb
+			}
+		}
+	}
+	return verbs
+}
@@ -15,8 +15,11 @@
 package tagexpr_test
 
 import (
+	"context"
+	"errors"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/bytedance/go-tagexpr/v2"
 	"github.com/stretchr/testify/assert"
@@ -98,3 +101,258 @@ func TestRangeIn(t *testing.T) {
 	})
 	assert.Equal(t, []interface{}{true, true, true}, r.Eval("F"))
 }
+
+func TestStringFunc(t *testing.T) {
+	var cases = []struct {
+		expr string
+		val  interface{}
+	}{
+		{expr: "contains((S)$, 'llo')", val: true},
+		{expr: "contains((S)$, 'xyz')", val: false},
+		{expr: "contains((N)$, '1')", val: false},
+		{expr: "hasPrefix((S)$, 'He') && hasSuffix((S)$, '世界')", val: true},
+		{expr: "lower((S)$)", val: "hello, 世界"},
+		{expr: "upper((S)$)", val: "HELLO, 世界"},
+		{expr: "trim('  a b ')", val: "a b"},
+		{expr: "trim('--a-b_', '-_')", val: "a-b"},
+		{expr: "split('a,b,c', ',')", val: []interface{}{"a", "b", "c"}},
+		{expr: "join((L)$, '-')", val: "x-1-true"},
+		{expr: "join(split('a,b', ','), '+')", val: "a+b"},
+		{expr: "replace('aaa', 'a', 'b')", val: "bbb"},
+		{expr: "replace('aaa', 'a', 'b', 2)", val: "bba"},
+		{expr: "indexOf((S)$, '世')", val: 7.0},
+		{expr: "indexOf((S)$, 'x')", val: -1.0},
+		{expr: "substr((S)$, 7)", val: "世界"},
+		{expr: "substr((S)$, 7, 1)", val: "世"},
+		{expr: "substr((S)$, indexOf((S)$, ','), 100)", val: ", 世界"},
+		{expr: "substr((S)$, 20)", val: ""},
+		{expr: "matches((S)$, '^H\\w+,')", val: true},
+		{expr: "matches((S)$, '^\\d+$')", val: false},
+		{expr: "matches((S)$, (P)$)", val: true},
+		{expr: "matches((S)$, (P)$+'[')", val: false},
+	}
+	data := map[string]interface{}{"S": "Hello, 世界", "N": 1, "L": []interface{}{"x", 1, true}, "P": "^H"}
+	for _, c := range cases {
+		p, err := tagexpr.Compile(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		val, err := p.Eval(data)
+		assert.NoError(t, err, c.expr)
+		assert.Equal(t, c.val, val, c.expr)
+	}
+}
+
+func TestMathFunc(t *testing.T) {
+	var cases = []struct {
+		expr string
+		val  interface{}
+	}{
+		{expr: "abs(-3)", val: int64(3)},
+		{expr: "abs(-2.5)", val: 2.5},
+		{expr: "abs(-9223372036854775807) == 9223372036854775807", val: true},
+		{expr: "abs('x')", val: nil},
+		{expr: "min(3, 1.5, 2)", val: 1.5},
+		{expr: "max(3, 1.5, 2)", val: int64(3)},
+		{expr: "-max(3, 1.5, 2)", val: int64(-3)},
+		{expr: "max((A)$, 9007199254740992) == 9007199254740993", val: true},
+		{expr: "min(1, 'x')", val: nil},
+		{expr: "clamp(150, 0, 100)", val: int64(100)},
+		{expr: "clamp(-1, 0, 100)", val: int64(0)},
+		{expr: "clamp(50, 0, 100)", val: int64(50)},
+		{expr: "floor(-1.5)", val: -2.0},
+		{expr: "ceil(1.2)", val: 2.0},
+		{expr: "round(2.5)", val: 3.0},
+		{expr: "round(1.2345, 2)", val: 1.23},
+		{expr: "round(-1.005, 1)", val: -1.0},
+		{expr: "pow(2, 10)", val: 1024.0},
+		{expr: "sqrt(16)", val: 4.0},
+		{expr: "isNaN(1/0)", val: true},
+		{expr: "isNaN(1/0)", val: true},
+		{expr: "isNaN(sqrt(-1))", val: true},
+		{expr: "isNaN(1)", val: false},
+		{expr: "isNaN(max(1, 0/0))", val: true},
+		{expr: "isInf(pow(10, 400))", val: true},
+		{expr: "isInf(-pow(10, 400), 1)", val: false},
+		{expr: "isInf(-pow(10, 400), -1)", val: true},
+		{expr: "isInf(1)", val: false},
+	}
+	data := map[string]interface{}{"A": int64(9007199254740993)}
+	for _, c := range cases {
+		p, err := tagexpr.Compile(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		val, err := p.Eval(data)
+		assert.NoError(t, err, c.expr)
+		assert.Equal(t, c.val, val, c.expr)
+	}
+}
+
+func TestVMRegFunc(t *testing.T) {
+	type T struct {
+		A string `te:"a:len($);b:double($)"`
+	}
+	vm1 := tagexpr.New("te")
+	vm1.MustRegFunc("len", func(args ...interface{}) interface{} {
+		return -1.0
+	})
+	vm1.MustRegFunc("double", func(args ...interface{}) interface{} {
+		return args[0].(string) + args[0].(string)
+	})
+	assert.Error(t, vm1.RegFunc("double", func(args ...interface{}) interface{} { return nil }))
+	assert.NoError(t, vm1.RegFunc("double", func(args ...interface{}) interface{} { return nil }, true))
+	te := vm1.MustRun(&T{A: "ab"})
+	assert.Equal(t, -1.0, te.Eval("A@a"))
+	assert.Equal(t, nil, te.Eval("A@b"))
+
+	vm2 := tagexpr.New("te")
+	_, err := vm2.Run(&T{A: "ab"})
+	assert.Error(t, err)
+	type T2 struct {
+		A string `te:"len($)"`
+	}
+	assert.Equal(t, 2.0, vm2.MustRun(&T2{A: "ab"}).Eval("A"))
+}
+
+func TestRegFuncCtx(t *testing.T) {
+	type ctxKey struct{}
+	vm := tagexpr.New("te")
+	vm.MustRegFuncCtx("locale", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		locale, ok := ctx.Value(ctxKey{}).(string)
+		if !ok {
+			return nil, errors.New("no locale")
+		}
+		return locale, nil
+	})
+	type T struct {
+		A string `te:"locale()==$"`
+		B string `te:"locale()"`
+	}
+	te := vm.MustRun(&T{A: "zh", B: "x"})
+	ctx := context.WithValue(context.Background(), ctxKey{}, "zh")
+	assert.Equal(t, true, te.EvalContext(ctx, "A"))
+	assert.Equal(t, "zh", te.EvalContext(ctx, "B"))
+	assert.Equal(t, false, te.Eval("A"))
+	assert.EqualError(t, te.Eval("B").(error), "no locale")
+	te.Range(func(eh *tagexpr.ExprHandler) error {
+		if eh.StringSelector() == "B" {
+			assert.Equal(t, "zh", eh.EvalContext(ctx))
+		}
+		return nil
+	})
+}
+
+func TestFuncSignature(t *testing.T) {
+	vm := tagexpr.New("te")
+	vm.MustRegFuncSig("between", tagexpr.FuncSignature{
+		In:  []tagexpr.Kind{tagexpr.NumberKind, tagexpr.NumberKind, tagexpr.NumberKind},
+		Out: tagexpr.BoolKind,
+	}, func(args ...interface{}) interface{} {
+		x, lo, hi := args[0].(float64), args[1].(float64), args[2].(float64)
+		return x >= lo && x <= hi
+	})
+	vm.MustRegFuncSig("oneOf", tagexpr.FuncSignature{
+		In:       []tagexpr.Kind{tagexpr.StringKind, tagexpr.StringKind},
+		Variadic: true,
+		Out:      tagexpr.BoolKind,
+	}, func(args ...interface{}) interface{} {
+		for _, arg := range args[1:] {
+			if arg == args[0] {
+				return true
+			}
+		}
+		return false
+	})
+	type T struct {
+		A int               `te:"between($, 1, 10)"`
+		B string            `te:"oneOf($, 'x', 'y') && between(len($), 1, 1)"`
+		C []string          `te:"between(len($), 0, 2) && oneOf($[0], 'x')"`
+		D interface{}       `te:"oneOf($)"`
+		E map[string]string `te:"oneOf($['k'], upper('x'), (B)$)"`
+	}
+	te := vm.MustRun(&T{A: 5, B: "x", C: []string{"x"}, E: map[string]string{"k": "X"}})
+	assert.Equal(t, true, te.Eval("A"))
+	assert.Equal(t, true, te.Eval("B"))
+	assert.Equal(t, true, te.Eval("C"))
+	assert.Equal(t, false, te.Eval("D"))
+	assert.Equal(t, true, te.Eval("E"))
+
+	// the integer arguments are kept by the opt-in
+	vm.MustRegFuncSig("isOdd", tagexpr.FuncSignature{
+		In:      []tagexpr.Kind{tagexpr.NumberKind},
+		Out:     tagexpr.BoolKind,
+		Integer: true,
+	}, func(args ...interface{}) interface{} {
+		n, ok := args[0].(int64)
+		return ok && n%2 == 1
+	})
+	type U struct {
+		ID int64 `te:"isOdd($)"`
+	}
+	assert.Equal(t, true, vm.MustRun(&U{ID: 9007199254740993}).Eval("ID"))
+	assert.Equal(t, false, vm.MustRun(&U{ID: 9007199254740992}).Eval("ID"))
+
+	var cases = []struct {
+		obj interface{}
+		err string
+	}{
+		{
+			obj: &struct {
+				A int `te:"between($, 1)"`
+			}{},
+			err: "expr @: between() expects 3 arguments, got 2 at offset 0",
+		},
+		{
+			obj: &struct {
+				A string `te:"x:!oneOf()"`
+			}{},
+			err: "expr x: oneOf() expects at least 1 argument, got 0 at offset 0",
+		},
+		{
+			obj: &struct {
+				A string `te:"between($, 1, 10)"`
+			}{},
+			err: "expr @: between() argument 1 expects number, got string at offset 0",
+		},
+		{
+			obj: &struct {
+				A []int `te:"len($)>0 && oneOf('x', 'y', $[0])"`
+			}{},
+			err: "expr @: oneOf() argument 3 expects string, got number at offset 12",
+		},
+		{
+			obj: &struct {
+				A int
+				B string `te:"between((A)$, 0, 1) || between(1, 0, (B)$)"`
+			}{},
+			err: "field B, tag te, expr @: between() argument 3 expects number, got string at offset 23",
+		},
+		{
+			obj: &struct {
+				A string `te:"substr($, 1, 2, 3)"`
+			}{},
+			err: "substr() expects 2 to 3 arguments, got 4 at offset 0",
+		},
+		{
+			obj: &struct {
+				A int `te:"lower($)"`
+			}{},
+			err: "lower() argument 1 expects string, got number at offset 0",
+		},
+		{
+			obj: &struct {
+				A time.Time `te:"before($, 1)"`
+			}{},
+			err: "before() argument 2 expects string|time, got number at offset 0",
+		},
+	}
+	for _, c := range cases {
+		_, err := vm.Run(c.obj)
+		if assert.Error(t, err, c.err) {
+			assert.Contains(t, err.Error(), c.err)
+		}
+	}
+	assert.Equal(t, "string|list", (tagexpr.StringKind | tagexpr.ListKind).String())
+	assert.Equal(t, "any", tagexpr.AnyKind.String())
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// --------------------------- Let ---------------------------
+//
+// The let-bindings before the expression bind the local variables,
+// e.g. let n = len((Items)$); n > 0 && n < 100:
+//
+//	the value is computed once for each evaluation;
+//	the binding can use the variables bound before it;
+//	the local variable shadows the env variable with the same name.
+
+// letExprNode the let-binding, whose left operand is the value and right operand is the body.
+type letExprNode struct {
+	exprBackground
+	name string
+}
+
+func (le *letExprNode) String() string {
+	return "let " + le.name
+}
+
+func (le *letExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	v := le.leftOperand.Run(ctx, currField, tagExpr)
+	return le.rightOperand.Run(context.WithValue(ctx, le, v), currField, tagExpr)
+}
+
+// letRegex the head of the let-binding, e.g. let n = of let n = len($); n > 0
+var letRegex = regexp.MustCompile(`^let[ \t]+([a-zA-Z_][a-zA-Z0-9_]*)[ \t]*=`)
+
+// readLetHead returns the variable name and the length of the head of the let-binding @s,
+// or the empty name if @s is not a let-binding.
+func readLetHead(s string) (name string, n int) {
+	m := letRegex.FindStringSubmatch(s)
+	if m == nil || strings.HasPrefix(s[len(m[0]):], "=") {
+		// let n == x
+		return "", 0
+	}
+	return m[1], len(m[0])
+}
+
+// letKeywords the names which can not be bound.
+var letKeywords = map[string]bool{"let": true, "true": true, "false": true, "nil": true}
+
+// parseLetExprNode parses the expression with the optional let-bindings into the group @e.
+func (p *Expr) parseLetExprNode(expr *string, e ExprNode) error {
+	trimLeftSpace(expr)
+	name, n := readLetHead(*expr)
+	if name == "" {
+		return p.parseExprNode(expr, e)
+	}
+	last := *expr
+	if letKeywords[name] {
+		return &SyntaxError{Expr: p.src, Offset: p.offsetOf(last), Msg: fmt.Sprintf("can not bind %q", name)}
+	}
+	*expr = (*expr)[n:]
+	val := newGroupExprNode()
+	if err := p.parseExprNode(expr, val); err != nil {
+		return err
+	}
+	if val.RightOperand() == nil {
+		return p.syntaxError(*expr, "operand")
+	}
+	sortPriority(val)
+	if trimLeftSpace(expr); !strings.HasPrefix(*expr, ";") {
+		return p.syntaxError(*expr, "';'")
+	}
+	*expr = (*expr)[1:]
+	le := &letExprNode{name: name}
+	setPos(le, p.offsetOf(last))
+	setEnd(le, p.offsetOf(*expr))
+	body := newGroupExprNode()
+	if err := p.parseLetExprNode(expr, body); err != nil {
+		return err
+	}
+	if body.RightOperand() == nil {
+		return p.syntaxErrorAt(p.offsetOf(*expr), "expression after the let-binding")
+	}
+	sortPriority(body)
+	le.SetLeftOperand(val)
+	val.SetParent(le)
+	le.SetRightOperand(body)
+	body.SetParent(le)
+	e.SetRightOperand(le)
+	le.SetParent(e)
+	le.bind(body)
+	return nil
+}
+
+// bind binds the free variables named as the let-binding in @node to it,
+// the variables of the inner bindings are bound first.
+func (le *letExprNode) bind(node ExprNode) {
+	Inspect(node, func(n ExprNode) bool {
+		if v, ok := n.(*variableExprNode); ok && v.val == le.name && v.local == nil {
+			v.local = le
+		}
+		return true
+	})
+}
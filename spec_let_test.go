@@ -0,0 +1,116 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bytedance/go-tagexpr/v2"
+)
+
+func TestLet(t *testing.T) {
+	var calls int
+	vm := tagexpr.New("te")
+	vm.MustRegFunc("tick", func(args ...interface{}) interface{} {
+		calls++
+		return float64(len(args))
+	})
+	type T struct {
+		A []int  `te:"let n = len($); n > 0 && n < 3"`
+		B []int  `te:"a:let n = len($); n > 1;b:let m = $[0]; let n = m * 2; n == 2;msg:'x;y'"`
+		C int    `te:"let n = tick(1, 2); n + n"`
+		D []int  `te:"let m = 2; range($, #v > m)"`
+		E string `te:"let s = $ + '!'; let s = s + s; s"`
+	}
+	te := vm.MustRun(&T{A: []int{1}, B: []int{1, 2}, E: "a"})
+	assert.Equal(t, true, te.Eval("A"))
+	assert.Equal(t, true, te.Eval("B@a"))
+	assert.Equal(t, true, te.Eval("B@b"))
+	assert.Equal(t, "x;y", te.Eval("B@msg"))
+	assert.Equal(t, 4.0, te.Eval("C"))
+	assert.Equal(t, 1, calls, "the value is computed once")
+	assert.Equal(t, "a!a!", te.Eval("E"))
+
+	te = vm.MustRun(&T{D: []int{1, 3}})
+	assert.Equal(t, false, te.Eval("A"))
+	assert.Equal(t, []interface{}{false, true}, te.Eval("D"))
+	assert.Equal(t, true, te.Explain("A").Value == false)
+
+	// the local variable shadows the env variable
+	p := tagexpr.MustCompile("let x = 1; x + y")
+	v, err := p.EvalWithEnv(nil, map[string]interface{}{"x": 5, "y": 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), v)
+	v, err = tagexpr.MustCompile("let n = 1; let n = n + 1; n").Eval(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), v)
+
+	// the local variables are not undeclared env variables
+	vm = tagexpr.New("te")
+	vm.MustDeclareEnv("max", tagexpr.EnvVar{Kind: tagexpr.NumberKind, Default: 2})
+	type U struct {
+		A []int `te:"let n = len($); n <= max"`
+	}
+	te = vm.MustRun(&U{A: []int{1, 2, 3}})
+	assert.Equal(t, false, te.Eval("A"))
+
+	// the kind of the local variable is checked
+	type V struct {
+		A string `te:"let s = $ + 'x'; s * 2 > 0"`
+	}
+	diags, err := vm.Check(reflect.TypeOf(V{}))
+	assert.NoError(t, err)
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, "operator * expects number|duration, got string", diags[0].Msg)
+	}
+}
+
+func TestLetFormat(t *testing.T) {
+	for _, src := range []string{
+		"let n = len($); n > 0",
+		"let n = 1; let m = n * 2; m + n",
+		"let s = $; s == nil ? false : len(s) > 0",
+	} {
+		p := tagexpr.MustCompile(src)
+		assert.Equal(t, src, tagexpr.Format(p.Root()), src)
+		assert.Equal(t, tagexpr.LetNode, tagexpr.KindOf(p.Root()), src)
+	}
+	assert.Equal(t, "n", tagexpr.NodeName(tagexpr.MustCompile("let n = 1; n").Root()))
+}
+
+func TestLetSyntaxError(t *testing.T) {
+	for _, c := range []struct {
+		src string
+		msg string
+	}{
+		{"let true = 1; 1", `can not bind "true"`},
+		{"let n = 1", `';'`},
+		{"let n = 1;", "expression after the let-binding"},
+		{"let n = ; n", "operand"},
+		{"let n = 1 n", `';'`},
+	} {
+		_, err := tagexpr.Compile(c.src)
+		if assert.Error(t, err, c.src) {
+			assert.Contains(t, err.Error(), c.msg, c.src)
+		}
+	}
+	// not a let-binding
+	v, err := tagexpr.MustCompile("let == 1").EvalWithEnv(nil, map[string]interface{}{"let": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, true, v)
+}
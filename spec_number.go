@@ -0,0 +1,476 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+)
+
+// --------------------------- Number ---------------------------
+//
+// The number operand is one of int64, uint64 and float64:
+//
+//	int64: the integer in the range of int64;
+//	uint64: the integer greater than math.MaxInt64;
+//	float64: the others.
+//
+// The integer arithmetic follows the Go semantics of int64 without wrapping:
+//
+//	int64 op int64 out of the int64 range is an integer overflow;
+//	if an operand is uint64, the exact result must be in the int64 or uint64 range;
+//	the integer remainder by zero is an error, as Go panics;
+//	NOTE: / is not the integer division, the quotient of two integers is an integer only if it is exact,
+//	e.g. 7/2 is 3.5 as before the integers were kept, and division by zero is NaN.
+//
+// The number error is an error value, which is passed through the operators and functions,
+// and is returned as the error by Program.Eval.
+
+// numberError the error of the number operation, e.g. integer overflow.
+type numberError struct {
+	msg string
+}
+
+func (e *numberError) Error() string {
+	return e.msg
+}
+
+// numberErrorOf returns the first number error of the operand values @a.
+func numberErrorOf(a ...interface{}) *numberError {
+	for _, v := range a {
+		if err, ok := v.(*numberError); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// numberOperand converts @v to number, and returns int64(0) if @v is not a number.
+func numberOperand(v interface{}) interface{} {
+	n, ok := toNumber(v, true)
+	if !ok {
+		return int64(0)
+	}
+	return n
+}
+
+func isFloatNumber(n interface{}) bool {
+	_, ok := n.(float64)
+	return ok
+}
+
+func bigIntOf(n interface{}) *big.Int {
+	switch t := n.(type) {
+	case int64:
+		return new(big.Int).SetInt64(t)
+	case uint64:
+		return new(big.Int).SetUint64(t)
+	}
+	return new(big.Int)
+}
+
+// bigIntResult converts @z to int64 or uint64, and returns false if overflow.
+func bigIntResult(z *big.Int) (interface{}, bool) {
+	if z.IsInt64() {
+		return z.Int64(), true
+	}
+	if z.IsUint64() {
+		return z.Uint64(), true
+	}
+	return nil, false
+}
+
+func overflowError(a interface{}, op string, b interface{}) error {
+	return &numberError{msg: fmt.Sprintf("integer overflow: %v %s %v", a, op, b)}
+}
+
+func divideByZeroError(a interface{}, op string) error {
+	return &numberError{msg: fmt.Sprintf("integer divide by zero: %v %s 0", a, op)}
+}
+
+// bigIntArith returns the exact integer result @z of @a op @b,
+// and the overflow error if it is out of the int64 range when both operands are int64.
+func bigIntArith(a interface{}, op string, b interface{}, z *big.Int) interface{} {
+	_, x := a.(int64)
+	_, y := b.(int64)
+	if x && y {
+		if z.IsInt64() {
+			return z.Int64()
+		}
+		return overflowError(a, op, b)
+	}
+	if r, ok := bigIntResult(z); ok {
+		return r
+	}
+	return overflowError(a, op, b)
+}
+
+func addNumber(a, b interface{}) interface{} {
+	if isFloatNumber(a) || isFloatNumber(b) {
+		return numberToFloat64(a) + numberToFloat64(b)
+	}
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			if z := x + y; (z > x) == (y > 0) {
+				return z
+			}
+		}
+	}
+	return bigIntArith(a, "+", b, new(big.Int).Add(bigIntOf(a), bigIntOf(b)))
+}
+
+func subNumber(a, b interface{}) interface{} {
+	if isFloatNumber(a) || isFloatNumber(b) {
+		return numberToFloat64(a) - numberToFloat64(b)
+	}
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			if z := x - y; (z < x) == (y > 0) {
+				return z
+			}
+		}
+	}
+	return bigIntArith(a, "-", b, new(big.Int).Sub(bigIntOf(a), bigIntOf(b)))
+}
+
+func mulNumber(a, b interface{}) interface{} {
+	if isFloatNumber(a) || isFloatNumber(b) {
+		return numberToFloat64(a) * numberToFloat64(b)
+	}
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			if x == 0 || y == 0 {
+				return int64(0)
+			}
+			if z := x * y; z/y == x && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64) {
+				return z
+			}
+		}
+	}
+	return bigIntArith(a, "*", b, new(big.Int).Mul(bigIntOf(a), bigIntOf(b)))
+}
+
+// divNumber returns NaN if @b is zero.
+// NOTE:
+//
+//	The quotient of two integers is an integer only if it is exact,
+//	otherwise it is float64, e.g. 6/3 is 2, 7/2 is 3.5.
+func divNumber(a, b interface{}) interface{} {
+	if isFloatNumber(a) || isFloatNumber(b) {
+		f := numberToFloat64(b)
+		if f == 0 {
+			return math.NaN()
+		}
+		return numberToFloat64(a) / f
+	}
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			if y == 0 {
+				return math.NaN()
+			}
+			if x%y != 0 {
+				return float64(x) / float64(y)
+			}
+			if x != math.MinInt64 || y != -1 {
+				return x / y
+			}
+		}
+	}
+	y := bigIntOf(b)
+	if y.Sign() == 0 {
+		return math.NaN()
+	}
+	q, m := new(big.Int).QuoRem(bigIntOf(a), y, new(big.Int))
+	if m.Sign() != 0 {
+		return numberToFloat64(a) / numberToFloat64(b)
+	}
+	return bigIntArith(a, "/", b, q)
+}
+
+// remNumber returns the error if the integer @b is zero, or NaN if the float64 @b is truncated to zero.
+// NOTE:
+//
+//	The remainder of two integers has the sign of the dividend, as Go;
+//	the float64 operands are truncated to integers: float64(int64(a)%int64(b)).
+func remNumber(a, b interface{}) interface{} {
+	if isFloatNumber(a) || isFloatNumber(b) {
+		y := int64(numberToFloat64(b))
+		if y == 0 {
+			return math.NaN()
+		}
+		if y == -1 {
+			return float64(0)
+		}
+		return float64(int64(numberToFloat64(a)) % y)
+	}
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			if y == 0 {
+				return divideByZeroError(a, "%")
+			}
+			if y == -1 {
+				return int64(0)
+			}
+			return x % y
+		}
+	}
+	y := bigIntOf(b)
+	if y.Sign() == 0 {
+		return divideByZeroError(a, "%")
+	}
+	r, _ := bigIntResult(new(big.Int).Rem(bigIntOf(a), y))
+	return r
+}
+
+// negNumber returns -@v if @v is a number, otherwise returns @v.
+func negNumber(v interface{}) interface{} {
+	switch t := v.(type) {
+	case int64:
+		if t == math.MinInt64 {
+			return uint64(1 << 63)
+		}
+		return -t
+	case uint64:
+		if t == 1<<63 {
+			return int64(math.MinInt64)
+		}
+		return -float64(t)
+	case float64:
+		return -t
+	case time.Duration:
+		return -t
+	}
+	return v
+}
+
+// compareNumber compares two numbers exactly,
+// and returns false if they are not comparable, e.g. NaN.
+func compareNumber(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return compareInt64(x, y), true
+		case uint64:
+			return -1, true
+		}
+	case uint64:
+		switch y := b.(type) {
+		case int64:
+			return 1, true
+		case uint64:
+			if x == y {
+				return 0, true
+			}
+			if x < y {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	if x, ok := exactFloat64(a); ok {
+		if y, ok := exactFloat64(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			case x == y:
+				return 0, true
+			}
+			// NaN
+			return 0, false
+		}
+	}
+	x, y := bigFloatOf(a), bigFloatOf(b)
+	if x == nil || y == nil {
+		return 0, false
+	}
+	return x.Cmp(y), true
+}
+
+// exactFloat64 returns the number @n as float64 if it is converted exactly,
+// i.e. the integer is within ±2^53.
+func exactFloat64(n interface{}) (float64, bool) {
+	const maxExact = 1 << 53
+	switch t := n.(type) {
+	case float64:
+		return t, true
+	case int64:
+		if t >= -maxExact && t <= maxExact {
+			return float64(t), true
+		}
+	case uint64:
+		if t <= maxExact {
+			return float64(t), true
+		}
+	}
+	return 0, false
+}
+
+func compareInt64(x, y int64) int {
+	if x == y {
+		return 0
+	}
+	if x < y {
+		return -1
+	}
+	return 1
+}
+
+func bigFloatOf(n interface{}) *big.Float {
+	switch t := n.(type) {
+	case int64:
+		return new(big.Float).SetInt64(t)
+	case uint64:
+		return new(big.Float).SetUint64(t)
+	case float64:
+		if math.IsNaN(t) {
+			return nil
+		}
+		return big.NewFloat(t)
+	}
+	return nil
+}
+
+// integerOperand converts @v to int64 or uint64 for the integer operator @op.
+// NOTE:
+//
+//	The float64 is accepted only if it is an integer.
+func integerOperand(v interface{}, op string) (interface{}, error) {
+	switch n := numberOperand(v).(type) {
+	case int64, uint64:
+		return n, nil
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			return int64(n), nil
+		}
+		return nil, &numberError{msg: fmt.Sprintf("non-integer operand of %s: %v", op, n)}
+	}
+	return int64(0), nil
+}
+
+// bitwiseNumber calculates the integer bitwise operator @op: & | ^ &^.
+func bitwiseNumber(a interface{}, op string, b interface{}) interface{} {
+	x, err := integerOperand(a, op)
+	if err != nil {
+		return err
+	}
+	y, err := integerOperand(b, op)
+	if err != nil {
+		return err
+	}
+	if x, ok := x.(int64); ok {
+		if y, ok := y.(int64); ok {
+			switch op {
+			case "&":
+				return x & y
+			case "|":
+				return x | y
+			case "^":
+				return x ^ y
+			default: // &^
+				return x &^ y
+			}
+		}
+	}
+	z := new(big.Int)
+	switch op {
+	case "&":
+		z.And(bigIntOf(x), bigIntOf(y))
+	case "|":
+		z.Or(bigIntOf(x), bigIntOf(y))
+	case "^":
+		z.Xor(bigIntOf(x), bigIntOf(y))
+	default: // &^
+		z.AndNot(bigIntOf(x), bigIntOf(y))
+	}
+	r, _ := bigIntResult(z)
+	return r
+}
+
+// shiftNumber calculates the integer shift operator @op: << >>.
+// NOTE:
+//
+//	The shift count must be non-negative;
+//	the left shift beyond the uint64 range results in an overflow error.
+func shiftNumber(a interface{}, op string, b interface{}) interface{} {
+	x, err := integerOperand(a, op)
+	if err != nil {
+		return err
+	}
+	y, err := integerOperand(b, op)
+	if err != nil {
+		return err
+	}
+	var n uint
+	switch c := y.(type) {
+	case int64:
+		if c < 0 {
+			return &numberError{msg: fmt.Sprintf("negative shift count: %v", c)}
+		}
+		if c > 128 {
+			c = 128
+		}
+		n = uint(c)
+	case uint64:
+		n = 128
+	}
+	z := bigIntOf(x)
+	if op == ">>" {
+		r, _ := bigIntResult(z.Rsh(z, n))
+		return r
+	}
+	if r, ok := bigIntResult(z.Lsh(z, n)); ok {
+		return r
+	}
+	return overflowError(a, op, b)
+}
+
+// absNumber returns the absolute value of the number @n.
+func absNumber(n interface{}) interface{} {
+	switch t := n.(type) {
+	case int64:
+		if t < 0 {
+			return negNumber(t)
+		}
+	case float64:
+		return math.Abs(t)
+	}
+	return n
+}
+
+// extremeNumber returns the minimum (@sign=-1) or maximum (@sign=1) of the numbers @args,
+// or NaN if any of them is NaN, or nil if any of them is not a number.
+func extremeNumber(args []interface{}, sign int) interface{} {
+	var r interface{}
+	for _, arg := range args {
+		n, ok := toNumber(arg, false)
+		if !ok {
+			return nil
+		}
+		if f, ok := n.(float64); ok && math.IsNaN(f) {
+			return f
+		}
+		if r == nil {
+			r = n
+		} else if c, _ := compareNumber(n, r); c == sign {
+			r = n
+		}
+	}
+	return r
+}
@@ -17,10 +17,12 @@ package tagexpr
 import (
 	"context"
 	"fmt"
+	"math"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/andeya/ameda"
 )
@@ -31,6 +33,7 @@ type groupExprNode struct {
 	exprBackground
 	boolOpposite *bool
 	signOpposite *bool
+	paren        bool // written in parentheses, false for the function argument or the ternary branch
 }
 
 func newGroupExprNode() ExprNode { return &groupExprNode{} }
@@ -42,7 +45,7 @@ func readGroupExprNode(expr *string) (grp ExprNode, subExprNode *string) {
 		return nil, nil
 	}
 	*expr = last
-	e := &groupExprNode{boolOpposite: boolOpposite, signOpposite: signOpposite}
+	e := &groupExprNode{boolOpposite: boolOpposite, signOpposite: signOpposite, paren: true}
 	return e, sptr
 }
 
@@ -66,7 +69,7 @@ func (be *boolExprNode) String() string {
 	return fmt.Sprintf("%v", be.val)
 }
 
-var boolRegexp = regexp.MustCompile(`^!*(true|false)([\)\],\|&!= \t]{1}|$)`)
+var boolRegexp = regexp.MustCompile(`^!*(true|false)([\)\],\|&!=\?;: \t]{1}|$)`)
 
 func readBoolExprNode(expr *string) ExprNode {
 	s := boolRegexp.FindString(*expr)
@@ -102,7 +105,7 @@ func (se *stringExprNode) String() string {
 
 func readStringExprNode(expr *string) ExprNode {
 	last, boolOpposite, _ := getBoolAndSignOpposite(expr)
-	sptr := readPairedSymbol(&last, '\'', '\'')
+	sptr := readQuotedString(&last)
 	if sptr == nil {
 		return nil
 	}
@@ -124,20 +127,35 @@ func (de *digitalExprNode) String() string {
 	return fmt.Sprintf("%v", de.val)
 }
 
-var digitalRegexp = regexp.MustCompile(`^[\+\-]?\d+(\.\d+)?([\)\],\+\-\*\/%><\|&!=\^ \t\\]|$)`)
+var digitalRegexp = regexp.MustCompile(`^[\+\-]?(0[xX][0-9a-fA-F]+|0[oO][0-7]+|0[bB][01]+|\d+(\.\d+)?)([\)\],\+\-\*\/%><\|&!=\^\?;: \t\\]|$)`)
 
 func readDigitalExprNode(expr *string) ExprNode {
 	last, boolOpposite := getOpposite(expr, "!")
-	s := digitalRegexp.FindString(last)
-	if s == "" {
+	a := digitalRegexp.FindStringSubmatch(last)
+	if a == nil {
 		return nil
 	}
-	if r := s[len(s)-1]; r < '0' || r > '9' {
-		s = s[:len(s)-1]
-	}
+	s := a[0][:len(a[0])-len(a[3])]
 	*expr = last[len(s):]
-	f64, _ := strconv.ParseFloat(s, 64)
-	return &digitalExprNode{val: realValue(f64, boolOpposite, nil)}
+	var n interface{}
+	if len(a[1]) > 1 && a[1][0] == '0' && a[1][1] > '9' {
+		// hexadecimal, octal or binary literal
+		n, _ = parseIntLiteral(s)
+	} else {
+		n, _ = parseNumber(s)
+	}
+	return &digitalExprNode{val: realValue(n, boolOpposite, nil)}
+}
+
+// parseIntLiteral parses the integer literal with 0x, 0o or 0b prefix.
+func parseIntLiteral(s string) (interface{}, bool) {
+	if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return i, true
+	}
+	if u, err := strconv.ParseUint(strings.TrimPrefix(s, "+"), 0, 64); err == nil {
+		return u, true
+	}
+	return nil, false
 }
 
 func (de *digitalExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
@@ -153,7 +171,7 @@ func (ne *nilExprNode) String() string {
 	return "<nil>"
 }
 
-var nilRegexp = regexp.MustCompile(`^nil([\)\],\|&!= \t]{1}|$)`)
+var nilRegexp = regexp.MustCompile(`^nil([\)\],\|&!=\?;: \t]{1}|$)`)
 
 func readNilExprNode(expr *string) ExprNode {
 	last, boolOpposite := getOpposite(expr, "!")
@@ -173,6 +191,8 @@ type variableExprNode struct {
 	exprBackground
 	boolOpposite *bool
 	val          string
+	def          interface{}  // the default value declared by VM.DeclareEnv
+	local        *letExprNode // the let-binding of the local variable
 }
 
 func (ve *variableExprNode) String() string {
@@ -180,21 +200,22 @@ func (ve *variableExprNode) String() string {
 }
 
 func (ve *variableExprNode) Run(ctx context.Context, variableName string, _ *TagExpr) interface{} {
-	envObj := ctx.Value(variableKey)
-	if envObj == nil {
-		return nil
-	}
-
-	env := envObj.(map[string]interface{})
-	if len(env) == 0 {
-		return nil
+	if ve.local != nil {
+		return realValue(ctx.Value(ve.local), ve.boolOpposite, nil)
 	}
+	env, _ := ctx.Value(variableKey).(map[string]interface{})
+	return ve.lookup(env)
+}
 
+// lookup returns the variable value in @env, or the declared default value.
+func (ve *variableExprNode) lookup(env map[string]interface{}) interface{} {
 	if value, ok := env[ve.val]; ok && value != nil {
 		return realValue(value, ve.boolOpposite, nil)
-	} else {
-		return nil
 	}
+	if ve.def != nil {
+		return realValue(ve.def, ve.boolOpposite, nil)
+	}
+	return nil
 }
 
 var variableRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*`)
@@ -257,59 +278,115 @@ func toString(i interface{}, enforce bool) (string, bool) {
 }
 
 func toFloat64(i interface{}, tryParse bool) (float64, bool) {
-	var v float64
-	var ok = true
+	n, ok := toNumber(i, tryParse)
+	if !ok {
+		return 0, false
+	}
+	return numberToFloat64(n), true
+}
+
+// toNumber converts the number (or numeric string if @tryParse) to int64, uint64 or float64.
+// NOTE:
+//
+//	The integer precision is kept;
+//	uint64 is used only when the value is greater than math.MaxInt64.
+func toNumber(i interface{}, tryParse bool) (interface{}, bool) {
 	switch t := i.(type) {
-	case float64:
-		v = t
+	case int64, float64:
+		return t, true
 	case float32:
-		v = float64(t)
+		return float64(t), true
 	case int:
-		v = float64(t)
+		return int64(t), true
 	case int8:
-		v = float64(t)
+		return int64(t), true
 	case int16:
-		v = float64(t)
+		return int64(t), true
 	case int32:
-		v = float64(t)
-	case int64:
-		v = float64(t)
+		return int64(t), true
 	case uint:
-		v = float64(t)
+		return uintToNumber(uint64(t)), true
 	case uint8:
-		v = float64(t)
+		return int64(t), true
 	case uint16:
-		v = float64(t)
+		return int64(t), true
 	case uint32:
-		v = float64(t)
+		return int64(t), true
 	case uint64:
-		v = float64(t)
+		return uintToNumber(t), true
 	case nil:
-		ok = false
+		return nil, false
 	default:
 		rv := ameda.DereferenceValue(reflect.ValueOf(t))
 		switch rv.Kind() {
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			v = float64(rv.Int())
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			v = float64(rv.Uint())
+			return rv.Int(), true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return uintToNumber(rv.Uint()), true
 		case reflect.Float32, reflect.Float64:
-			v = rv.Float()
+			return rv.Float(), true
 		default:
 			if tryParse {
 				if s, ok := toString(i, false); ok {
-					var err error
-					v, err = strconv.ParseFloat(s, 64)
-					return v, err == nil
+					return parseNumber(s)
 				}
 			}
-			ok = false
 		}
 	}
-	return v, ok
+	return nil, false
+}
+
+func uintToNumber(u uint64) interface{} {
+	if u > math.MaxInt64 {
+		return u
+	}
+	return int64(u)
+}
+
+// parseNumber parses the numeric string to int64, uint64 or float64.
+func parseNumber(s string) (interface{}, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, true
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+func numberToFloat64(n interface{}) float64 {
+	switch t := n.(type) {
+	case int64:
+		return float64(t)
+	case uint64:
+		return float64(t)
+	case float64:
+		return t
+	}
+	return 0
+}
+
+// normalizeNumber converts the integer result to Number(float64),
+// which is the unified number type outside the expression.
+func normalizeNumber(v interface{}) interface{} {
+	switch t := v.(type) {
+	case int64:
+		return float64(t)
+	case uint64:
+		return float64(t)
+	case []interface{}:
+		for k, v := range t {
+			t[k] = normalizeNumber(v)
+		}
+	}
+	return v
 }
 
 func realValue(v interface{}, boolOpposite *bool, signOpposite *bool) interface{} {
+	if err := numberErrorOf(v); err != nil {
+		return err
+	}
 	if boolOpposite != nil {
 		bol := FakeBool(v)
 		if *boolOpposite {
@@ -318,50 +395,27 @@ func realValue(v interface{}, boolOpposite *bool, signOpposite *bool) interface{
 		return bol
 	}
 	switch t := v.(type) {
-	case float64, string:
-	case float32:
-		v = float64(t)
-	case int:
-		v = float64(t)
-	case int8:
-		v = float64(t)
-	case int16:
-		v = float64(t)
-	case int32:
-		v = float64(t)
-	case int64:
-		v = float64(t)
-	case uint:
-		v = float64(t)
-	case uint8:
-		v = float64(t)
-	case uint16:
-		v = float64(t)
-	case uint32:
-		v = float64(t)
-	case uint64:
-		v = float64(t)
+	case int64, float64, string, time.Duration, time.Time:
+	case *time.Time:
+		if t != nil {
+			v = *t
+		}
 	case []interface{}:
 		for k, v := range t {
 			t[k] = realValue(v, boolOpposite, signOpposite)
 		}
 	default:
+		if n, ok := toNumber(v, false); ok {
+			v = n
+			break
+		}
 		rv := ameda.DereferenceValue(reflect.ValueOf(v))
-		switch rv.Kind() {
-		case reflect.String:
+		if rv.Kind() == reflect.String {
 			v = rv.String()
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			v = float64(rv.Int())
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			v = float64(rv.Uint())
-		case reflect.Float32, reflect.Float64:
-			v = rv.Float()
 		}
 	}
 	if signOpposite != nil && *signOpposite {
-		if f, ok := v.(float64); ok {
-			v = -f
-		}
+		v = negNumber(v)
 	}
 	return v
 }
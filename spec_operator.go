@@ -16,11 +16,19 @@ package tagexpr
 
 import (
 	"context"
-	"math"
+	"reflect"
 )
 
 // --------------------------- Operator ---------------------------
 
+// binaryOperator the operator which evaluates both operands,
+// i.e. all the binary operators except && and ||.
+type binaryOperator interface {
+	ExprNode
+	// operate returns the result of the operator on the operand values
+	operate(v0, v1 interface{}) interface{}
+}
+
 type additionExprNode struct{ exprBackground }
 
 func (ae *additionExprNode) String() string {
@@ -30,12 +38,19 @@ func (ae *additionExprNode) String() string {
 func newAdditionExprNode() ExprNode { return &additionExprNode{} }
 
 func (ae *additionExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	return ae.operate(ae.leftOperand.Run(ctx, currField, tagExpr), ae.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*additionExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
 	// positive number or Addition
-	v0 := ae.leftOperand.Run(ctx, currField, tagExpr)
-	v1 := ae.rightOperand.Run(ctx, currField, tagExpr)
-	if s0, ok := toFloat64(v0, false); ok {
-		s1, _ := toFloat64(v1, true)
-		return s0 + s1
+	if r, ok := addTime(v0, v1); ok {
+		return r
+	}
+	if s0, ok := toNumber(v0, false); ok {
+		return addNumber(s0, numberOperand(v1))
 	}
 	if s0, ok := toString(v0, false); ok {
 		s1, _ := toString(v1, true)
@@ -53,9 +68,15 @@ func (ae *multiplicationExprNode) String() string {
 func newMultiplicationExprNode() ExprNode { return &multiplicationExprNode{} }
 
 func (ae *multiplicationExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	v0, _ := toFloat64(ae.leftOperand.Run(ctx, currField, tagExpr), true)
-	v1, _ := toFloat64(ae.rightOperand.Run(ctx, currField, tagExpr), true)
-	return v0 * v1
+	return ae.operate(ae.leftOperand.Run(ctx, currField, tagExpr), ae.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*multiplicationExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	v0, v1 = numberOperand(v0), numberOperand(v1)
+	return mulNumber(v0, v1)
 }
 
 type divisionExprNode struct{ exprBackground }
@@ -67,12 +88,15 @@ func (de *divisionExprNode) String() string {
 func newDivisionExprNode() ExprNode { return &divisionExprNode{} }
 
 func (de *divisionExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	v1, _ := toFloat64(de.rightOperand.Run(ctx, currField, tagExpr), true)
-	if v1 == 0 {
-		return math.NaN()
+	return de.operate(de.leftOperand.Run(ctx, currField, tagExpr), de.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*divisionExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
 	}
-	v0, _ := toFloat64(de.leftOperand.Run(ctx, currField, tagExpr), true)
-	return v0 / v1
+	v0, v1 = numberOperand(v0), numberOperand(v1)
+	return divNumber(v0, v1)
 }
 
 type subtractionExprNode struct{ exprBackground }
@@ -84,9 +108,17 @@ func (de *subtractionExprNode) String() string {
 func newSubtractionExprNode() ExprNode { return &subtractionExprNode{} }
 
 func (de *subtractionExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	v0, _ := toFloat64(de.leftOperand.Run(ctx, currField, tagExpr), true)
-	v1, _ := toFloat64(de.rightOperand.Run(ctx, currField, tagExpr), true)
-	return v0 - v1
+	return de.operate(de.leftOperand.Run(ctx, currField, tagExpr), de.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*subtractionExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	if r, ok := subTime(v0, v1); ok {
+		return r
+	}
+	return subNumber(numberOperand(v0), numberOperand(v1))
 }
 
 type remainderExprNode struct{ exprBackground }
@@ -98,12 +130,129 @@ func (re *remainderExprNode) String() string {
 func newRemainderExprNode() ExprNode { return &remainderExprNode{} }
 
 func (re *remainderExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	v1, _ := toFloat64(re.rightOperand.Run(ctx, currField, tagExpr), true)
-	if v1 == 0 {
-		return math.NaN()
+	return re.operate(re.leftOperand.Run(ctx, currField, tagExpr), re.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*remainderExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	v0, v1 = numberOperand(v0), numberOperand(v1)
+	return remNumber(v0, v1)
+}
+
+type bitAndExprNode struct{ exprBackground }
+
+func (ba *bitAndExprNode) String() string {
+	return "&"
+}
+
+func newBitAndExprNode() ExprNode { return &bitAndExprNode{} }
+
+func (ba *bitAndExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	return ba.operate(ba.leftOperand.Run(ctx, currField, tagExpr), ba.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*bitAndExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	return bitwiseNumber(v0, "&", v1)
+}
+
+type bitOrExprNode struct{ exprBackground }
+
+func (bo *bitOrExprNode) String() string {
+	return "|"
+}
+
+func newBitOrExprNode() ExprNode { return &bitOrExprNode{} }
+
+func (bo *bitOrExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	return bo.operate(bo.leftOperand.Run(ctx, currField, tagExpr), bo.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*bitOrExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	return bitwiseNumber(v0, "|", v1)
+}
+
+type bitXorExprNode struct{ exprBackground }
+
+func (bx *bitXorExprNode) String() string {
+	return "^"
+}
+
+func newBitXorExprNode() ExprNode { return &bitXorExprNode{} }
+
+func (bx *bitXorExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	return bx.operate(bx.leftOperand.Run(ctx, currField, tagExpr), bx.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*bitXorExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	return bitwiseNumber(v0, "^", v1)
+}
+
+type bitClearExprNode struct{ exprBackground }
+
+func (bc *bitClearExprNode) String() string {
+	return "&^"
+}
+
+func newBitClearExprNode() ExprNode { return &bitClearExprNode{} }
+
+func (bc *bitClearExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	return bc.operate(bc.leftOperand.Run(ctx, currField, tagExpr), bc.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*bitClearExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	return bitwiseNumber(v0, "&^", v1)
+}
+
+type shiftLeftExprNode struct{ exprBackground }
+
+func (sl *shiftLeftExprNode) String() string {
+	return "<<"
+}
+
+func newShiftLeftExprNode() ExprNode { return &shiftLeftExprNode{} }
+
+func (sl *shiftLeftExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	return sl.operate(sl.leftOperand.Run(ctx, currField, tagExpr), sl.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*shiftLeftExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
 	}
-	v0, _ := toFloat64(re.leftOperand.Run(ctx, currField, tagExpr), true)
-	return float64(int64(v0) % int64(v1))
+	return shiftNumber(v0, "<<", v1)
+}
+
+type shiftRightExprNode struct{ exprBackground }
+
+func (sr *shiftRightExprNode) String() string {
+	return ">>"
+}
+
+func newShiftRightExprNode() ExprNode { return &shiftRightExprNode{} }
+
+func (sr *shiftRightExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	return sr.operate(sr.leftOperand.Run(ctx, currField, tagExpr), sr.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*shiftRightExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	return shiftNumber(v0, ">>", v1)
 }
 
 type equalExprNode struct{ exprBackground }
@@ -115,14 +264,23 @@ func (ee *equalExprNode) String() string {
 func newEqualExprNode() ExprNode { return &equalExprNode{} }
 
 func (ee *equalExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	v0 := ee.leftOperand.Run(ctx, currField, tagExpr)
-	v1 := ee.rightOperand.Run(ctx, currField, tagExpr)
-	if v0 == v1 {
+	return ee.operate(ee.leftOperand.Run(ctx, currField, tagExpr), ee.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*equalExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	if equalValue(v0, v1) {
 		return true
 	}
-	if s0, ok := toFloat64(v0, false); ok {
-		if s1, ok := toFloat64(v1, true); ok {
-			return s0 == s1
+	if c, ok := compareTime(v0, v1); ok {
+		return c == 0
+	}
+	if s0, ok := toNumber(v0, false); ok {
+		if s1, ok := toNumber(v1, true); ok {
+			c, ok := compareNumber(s0, s1)
+			return ok && c == 0
 		}
 	}
 	if s0, ok := toString(v0, false); ok {
@@ -143,6 +301,29 @@ func (ee *equalExprNode) Run(ctx context.Context, currField string, tagExpr *Tag
 	return false
 }
 
+// equalValue returns v0 == v1, or false if they are not comparable,
+// e.g. the structs with the slice fields selected by $root and $parent.
+func equalValue(v0, v1 interface{}) (eq bool) {
+	t := reflect.TypeOf(v0)
+	if t == nil || t != reflect.TypeOf(v1) {
+		return v0 == v1
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Array:
+		// the interface fields or elements may hold the uncomparable values
+		defer func() {
+			if recover() != nil {
+				eq = false
+			}
+		}()
+	default:
+		if !t.Comparable() {
+			return false
+		}
+	}
+	return v0 == v1
+}
+
 type notEqualExprNode struct{ equalExprNode }
 
 func (ne *notEqualExprNode) String() string {
@@ -152,7 +333,15 @@ func (ne *notEqualExprNode) String() string {
 func newNotEqualExprNode() ExprNode { return &notEqualExprNode{} }
 
 func (ne *notEqualExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	return !ne.equalExprNode.Run(ctx, currField, tagExpr).(bool)
+	return ne.operate(ne.leftOperand.Run(ctx, currField, tagExpr), ne.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (ne *notEqualExprNode) operate(v0, v1 interface{}) interface{} {
+	r := ne.equalExprNode.operate(v0, v1)
+	if b, ok := r.(bool); ok {
+		return !b
+	}
+	return r
 }
 
 type greaterExprNode struct{ exprBackground }
@@ -164,11 +353,20 @@ func (ge *greaterExprNode) String() string {
 func newGreaterExprNode() ExprNode { return &greaterExprNode{} }
 
 func (ge *greaterExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	v0 := ge.leftOperand.Run(ctx, currField, tagExpr)
-	v1 := ge.rightOperand.Run(ctx, currField, tagExpr)
-	if s0, ok := toFloat64(v0, false); ok {
-		if s1, ok := toFloat64(v1, true); ok {
-			return s0 > s1
+	return ge.operate(ge.leftOperand.Run(ctx, currField, tagExpr), ge.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*greaterExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	if c, ok := compareTime(v0, v1); ok {
+		return c > 0
+	}
+	if s0, ok := toNumber(v0, false); ok {
+		if s1, ok := toNumber(v1, true); ok {
+			c, ok := compareNumber(s0, s1)
+			return ok && c > 0
 		}
 	}
 	if s0, ok := toString(v0, false); ok {
@@ -189,11 +387,20 @@ func (ge *greaterEqualExprNode) String() string {
 func newGreaterEqualExprNode() ExprNode { return &greaterEqualExprNode{} }
 
 func (ge *greaterEqualExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	v0 := ge.leftOperand.Run(ctx, currField, tagExpr)
-	v1 := ge.rightOperand.Run(ctx, currField, tagExpr)
-	if s0, ok := toFloat64(v0, false); ok {
-		if s1, ok := toFloat64(v1, true); ok {
-			return s0 >= s1
+	return ge.operate(ge.leftOperand.Run(ctx, currField, tagExpr), ge.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*greaterEqualExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	if c, ok := compareTime(v0, v1); ok {
+		return c >= 0
+	}
+	if s0, ok := toNumber(v0, false); ok {
+		if s1, ok := toNumber(v1, true); ok {
+			c, ok := compareNumber(s0, s1)
+			return ok && c >= 0
 		}
 	}
 	if s0, ok := toString(v0, false); ok {
@@ -214,11 +421,20 @@ func (le *lessExprNode) String() string {
 func newLessExprNode() ExprNode { return &lessExprNode{} }
 
 func (le *lessExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	v0 := le.leftOperand.Run(ctx, currField, tagExpr)
-	v1 := le.rightOperand.Run(ctx, currField, tagExpr)
-	if s0, ok := toFloat64(v0, false); ok {
-		if s1, ok := toFloat64(v1, true); ok {
-			return s0 < s1
+	return le.operate(le.leftOperand.Run(ctx, currField, tagExpr), le.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*lessExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	if c, ok := compareTime(v0, v1); ok {
+		return c < 0
+	}
+	if s0, ok := toNumber(v0, false); ok {
+		if s1, ok := toNumber(v1, true); ok {
+			c, ok := compareNumber(s0, s1)
+			return ok && c < 0
 		}
 	}
 	if s0, ok := toString(v0, false); ok {
@@ -239,11 +455,20 @@ func (le *lessEqualExprNode) String() string {
 func newLessEqualExprNode() ExprNode { return &lessEqualExprNode{} }
 
 func (le *lessEqualExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	v0 := le.leftOperand.Run(ctx, currField, tagExpr)
-	v1 := le.rightOperand.Run(ctx, currField, tagExpr)
-	if s0, ok := toFloat64(v0, false); ok {
-		if s1, ok := toFloat64(v1, true); ok {
-			return s0 <= s1
+	return le.operate(le.leftOperand.Run(ctx, currField, tagExpr), le.rightOperand.Run(ctx, currField, tagExpr))
+}
+
+func (*lessEqualExprNode) operate(v0, v1 interface{}) interface{} {
+	if err := numberErrorOf(v0, v1); err != nil {
+		return err
+	}
+	if c, ok := compareTime(v0, v1); ok {
+		return c <= 0
+	}
+	if s0, ok := toNumber(v0, false); ok {
+		if s1, ok := toNumber(v1, true); ok {
+			c, ok := compareNumber(s0, s1)
+			return ok && c <= 0
 		}
 	}
 	if s0, ok := toString(v0, false); ok {
@@ -263,13 +488,12 @@ func (ae *andExprNode) String() string {
 
 func newAndExprNode() ExprNode { return &andExprNode{} }
 
+// Run evaluates the left operand first,
+// and the right operand only if the left one is true.
 func (ae *andExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	for _, e := range [2]ExprNode{ae.leftOperand, ae.rightOperand} {
-		if !FakeBool(e.Run(ctx, currField, tagExpr)) {
-			return false
-		}
-	}
-	return true
+	return logicResult(ae.leftOperand.Run(ctx, currField, tagExpr), false, func() interface{} {
+		return ae.rightOperand.Run(ctx, currField, tagExpr)
+	})
 }
 
 type orExprNode struct{ exprBackground }
@@ -280,11 +504,58 @@ func (oe *orExprNode) String() string {
 
 func newOrExprNode() ExprNode { return &orExprNode{} }
 
+// Run evaluates the left operand first,
+// and the right operand only if the left one is false.
 func (oe *orExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	for _, e := range [2]ExprNode{oe.leftOperand, oe.rightOperand} {
-		if FakeBool(e.Run(ctx, currField, tagExpr)) {
-			return true
-		}
+	return logicResult(oe.leftOperand.Run(ctx, currField, tagExpr), true, func() interface{} {
+		return oe.rightOperand.Run(ctx, currField, tagExpr)
+	})
+}
+
+// logicResult returns the result of && (@or=false) or || (@or=true) with the left operand value @l,
+// and evaluates the right operand by @r only if needed;
+// the number error of the operands is passed through.
+func logicResult(l interface{}, or bool, r func() interface{}) interface{} {
+	if err := numberErrorOf(l); err != nil {
+		return err
 	}
-	return false
+	if FakeBool(l) == or {
+		return or
+	}
+	v := r()
+	if err := numberErrorOf(v); err != nil {
+		return err
+	}
+	return FakeBool(v)
+}
+
+type ternaryExprNode struct{ exprBackground }
+
+func (te *ternaryExprNode) String() string {
+	return "?"
 }
+
+func newTernaryExprNode() ExprNode { return &ternaryExprNode{} }
+
+// Run evaluates the condition (the left operand) first,
+// and then only one of the branches (the right operand).
+func (te *ternaryExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	cond := te.leftOperand.Run(ctx, currField, tagExpr)
+	if err := numberErrorOf(cond); err != nil {
+		return err
+	}
+	if FakeBool(cond) {
+		return te.rightOperand.LeftOperand().Run(ctx, currField, tagExpr)
+	}
+	return te.rightOperand.RightOperand().Run(ctx, currField, tagExpr)
+}
+
+// ternaryBranchesExprNode the branches of ternary expression,
+// the left operand is the true branch and the right operand is the false branch.
+type ternaryBranchesExprNode struct{ exprBackground }
+
+func (tb *ternaryBranchesExprNode) String() string {
+	return ":"
+}
+
+func newTernaryBranchesExprNode() ExprNode { return &ternaryBranchesExprNode{} }
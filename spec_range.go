@@ -2,8 +2,15 @@ package tagexpr
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
 )
 
 type rangeCtxKey string
@@ -17,21 +24,23 @@ const (
 type rangeKvExprNode struct {
 	exprBackground
 	ctxKey       rangeCtxKey
+	fieldPath    string
 	boolOpposite *bool
 	signOpposite *bool
 }
 
 func (re *rangeKvExprNode) String() string {
-	return string(re.ctxKey)
+	return string(re.ctxKey) + re.fieldPath
 }
 
 func (p *Expr) readRangeKvExprNode(expr *string) ExprNode {
-	name, boolOpposite, signOpposite, found := findRangeKv(expr)
+	name, fieldPath, boolOpposite, signOpposite, found := findRangeKv(expr)
 	if !found {
 		return nil
 	}
 	operand := &rangeKvExprNode{
 		ctxKey:       rangeCtxKey(name),
+		fieldPath:    fieldPath,
 		boolOpposite: boolOpposite,
 		signOpposite: signOpposite,
 	}
@@ -39,9 +48,9 @@ func (p *Expr) readRangeKvExprNode(expr *string) ExprNode {
 	return operand
 }
 
-var rangeKvRegexp = regexp.MustCompile(`^([\!\+\-]*)(#[kv#])([\)\[\],\+\-\*\/%><\|&!=\^ \t\\]|$)`)
+var rangeKvRegexp = regexp.MustCompile(`^([\!\+\-]*)(#[kv#])((?:\.[A-Za-z_][A-Za-z0-9_]*)*)([\)\[\],\+\-\*\/%><\|&!=\^\?: \t\\]|$)`)
 
-func findRangeKv(expr *string) (name string, boolOpposite, signOpposite *bool, found bool) {
+func findRangeKv(expr *string) (name, fieldPath string, boolOpposite, signOpposite *bool, found bool) {
 	raw := *expr
 	a := rangeKvRegexp.FindAllStringSubmatch(raw, -1)
 	if len(a) != 1 {
@@ -49,7 +58,8 @@ func findRangeKv(expr *string) (name string, boolOpposite, signOpposite *bool, f
 	}
 	r := a[0]
 	name = r[2]
-	*expr = (*expr)[len(a[0][0])-len(r[3]):]
+	fieldPath = r[3]
+	*expr = (*expr)[len(a[0][0])-len(r[4]):]
 	prefix := r[1]
 	if len(prefix) == 0 {
 		found = true
@@ -61,19 +71,36 @@ func findRangeKv(expr *string) (name string, boolOpposite, signOpposite *bool, f
 }
 
 func (re *rangeKvExprNode) Run(ctx context.Context, _ string, _ *TagExpr) interface{} {
+	return re.value(ctx.Value(re.ctxKey))
+}
+
+// value returns the result with the value @val of #k, #v or ##.
+func (re *rangeKvExprNode) value(val interface{}) interface{} {
 	var v interface{}
-	switch val := ctx.Value(re.ctxKey).(type) {
-	case reflect.Value:
-		if !val.IsValid() || !val.CanInterface() {
-			return nil
+	if re.fieldPath != "" {
+		rv, ok := val.(reflect.Value)
+		if !ok {
+			rv = reflect.ValueOf(val)
 		}
-		v = val.Interface()
-	default:
-		v = val
+		// e.g. #v.Name.First
+		v = getSubValue(getDataField(rv, re.fieldPath[1:]), nil)
+	} else {
+		v = rangeElemValue(val)
 	}
 	return realValue(v, re.boolOpposite, re.signOpposite)
 }
 
+// rangeElemValue returns the interface value of the range key or element.
+func rangeElemValue(val interface{}) interface{} {
+	if rv, ok := val.(reflect.Value); ok {
+		if !rv.IsValid() || !rv.CanInterface() {
+			return nil
+		}
+		return rv.Interface()
+	}
+	return val
+}
+
 type rangeFuncExprNode struct {
 	exprBackground
 	object       ExprNode
@@ -105,46 +132,378 @@ func readRangeFuncExprNode(p *Expr, expr *string) ExprNode {
 }
 
 func (e *rangeFuncExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
-	var r []interface{}
 	obj := e.object.Run(ctx, currField, tagExpr)
-	// fmt.Printf("%v\n", obj)
+	return e.rangeValues(obj, func(el rangeElem) interface{} {
+		return e.elemExprNode.Run(el.context(ctx), currField, tagExpr)
+	})
+}
+
+// rangeValues returns the results of @eval for each element of @obj.
+func (e *rangeFuncExprNode) rangeValues(obj interface{}, eval func(rangeElem) interface{}) interface{} {
+	var r []interface{}
+	count := rangeLenOf(obj)
+	if count < 0 {
+		return r
+	}
+	r = make([]interface{}, 0, count)
+	rangeEach(obj, func(el rangeElem) bool {
+		r = append(r, realValue(eval(el), e.boolOpposite, e.signOpposite))
+		return true
+	})
+	return r
+}
+
+// rangeLenOf returns the number of elements of array, slice or map @obj,
+// or -1 if @obj is not one of them.
+func rangeLenOf(obj interface{}) int {
+	objval := reflect.ValueOf(obj)
+	switch objval.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map:
+		return objval.Len()
+	}
+	return -1
+}
+
+// rangeElem the range key #k, element #v and length ## of one element.
+type rangeElem struct {
+	k, v interface{} // int or reflect.Value, and reflect.Value
+	n    int
+}
+
+// context returns the context carrying #k, #v and ##.
+func (el rangeElem) context(ctx context.Context) context.Context {
+	return context.WithValue(context.WithValue(context.WithValue(ctx, rangeLen, el.n), rangeKey, el.k), rangeValue, el.v)
+}
+
+// rangeEach calls @fn with #k, #v and ## for each element of array, slice or map @obj,
+// until @fn returns false.
+// NOTE:
+//
+//	The map keys are iterated in sorted order.
+func rangeEach(obj interface{}, fn func(rangeElem) bool) {
 	objval := reflect.ValueOf(obj)
 	switch objval.Kind() {
 	case reflect.Array, reflect.Slice:
 		count := objval.Len()
-		r = make([]interface{}, count)
-		ctx = context.WithValue(ctx, rangeLen, count)
 		for i := 0; i < count; i++ {
-			// fmt.Printf("%#v,  (%v)\n", e.elemExprNode, objval.Index(i))
-			r[i] = realValue(e.elemExprNode.Run(
-				context.WithValue(
-					context.WithValue(
-						ctx,
-						rangeKey, i,
-					),
-					rangeValue, objval.Index(i),
-				),
-				currField, tagExpr,
-			), e.boolOpposite, e.signOpposite)
+			if !fn(rangeElem{k: i, v: objval.Index(i), n: count}) {
+				return
+			}
 		}
 	case reflect.Map:
-		keys := objval.MapKeys()
-		count := len(keys)
-		r = make([]interface{}, count)
-		ctx = context.WithValue(ctx, rangeLen, count)
-		for i, key := range keys {
-			r[i] = realValue(e.elemExprNode.Run(
-				context.WithValue(
-					context.WithValue(
-						ctx,
-						rangeKey, key,
-					),
-					rangeValue, objval.MapIndex(key),
-				),
-				currField, tagExpr,
-			), e.boolOpposite, e.signOpposite)
+		keys := sortedMapKeys(objval)
+		for _, key := range keys {
+			if !fn(rangeElem{k: key, v: objval.MapIndex(key), n: len(keys)}) {
+				return
+			}
 		}
 	default:
 	}
-	return r
+}
+
+func sortedMapKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		for a.Kind() == reflect.Interface || a.Kind() == reflect.Ptr {
+			a = a.Elem()
+		}
+		for b.Kind() == reflect.Interface || b.Kind() == reflect.Ptr {
+			b = b.Elem()
+		}
+		if a.Kind() == b.Kind() {
+			switch a.Kind() {
+			case reflect.String:
+				return a.String() < b.String()
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return a.Int() < b.Int()
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+				return a.Uint() < b.Uint()
+			case reflect.Float32, reflect.Float64:
+				return a.Float() < b.Float()
+			case reflect.Bool:
+				return !a.Bool() && b.Bool()
+			}
+		}
+		return fmt.Sprint(rangeElemValue(a)) < fmt.Sprint(rangeElemValue(b))
+	})
+	return keys
+}
+
+// collectionFuncExprNode the collection function: all, any, none, count, filter, map, unique.
+type collectionFuncExprNode struct {
+	exprBackground
+	name         string
+	object       ExprNode
+	elemExprNode ExprNode
+	boolOpposite *bool
+	signOpposite *bool
+}
+
+func (e *collectionFuncExprNode) String() string {
+	return e.name + "()"
+}
+
+// newCollectionFunc creates the collection function expression reader, e.g.
+// any($, #v.Role=='admin')
+// count($, #v>0)
+// unique($, #v.ID)
+func newCollectionFunc(funcName string) func(*Expr, *string) ExprNode {
+	return func(p *Expr, expr *string) ExprNode {
+		last := *expr
+		boolOpposite, signOpposite, args, found := p.parseFuncSign(funcName, expr)
+		if !found {
+			return nil
+		}
+		if len(args) != 2 && (funcName != "unique" || len(args) != 1) {
+			p.setErr(&SyntaxError{
+				Expr:   p.src,
+				Offset: p.offsetOf(last),
+				Msg:    fmt.Sprintf("%s() expects 2 arguments, got %d", funcName, len(args)),
+			})
+			return nil
+		}
+		e := &collectionFuncExprNode{
+			name:         funcName,
+			boolOpposite: boolOpposite,
+			signOpposite: signOpposite,
+			object:       args[0],
+		}
+		if len(args) == 2 {
+			e.elemExprNode = args[1]
+		}
+		return e
+	}
+}
+
+func (e *collectionFuncExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	obj := e.object.Run(ctx, currField, tagExpr)
+	return e.collect(obj, func(el rangeElem) interface{} {
+		return e.elemExprNode.Run(el.context(ctx), currField, tagExpr)
+	})
+}
+
+// collect returns the result of the collection function on @obj,
+// where @eval returns the result of the element expression.
+func (e *collectionFuncExprNode) collect(obj interface{}, eval func(rangeElem) interface{}) interface{} {
+	var r interface{}
+	switch e.name {
+	case "all":
+		r = e.find(obj, eval, false) < 0
+	case "any":
+		r = e.find(obj, eval, true) >= 0
+	case "none":
+		r = e.find(obj, eval, true) < 0
+	case "count":
+		var n int64
+		rangeEach(obj, func(el rangeElem) bool {
+			if FakeBool(eval(el)) {
+				n++
+			}
+			return true
+		})
+		r = n
+	case "filter":
+		var a []interface{}
+		if n := rangeLenOf(obj); n >= 0 {
+			a = make([]interface{}, 0, n)
+		}
+		rangeEach(obj, func(el rangeElem) bool {
+			if FakeBool(eval(el)) {
+				a = append(a, realValue(rangeElemValue(el.v), nil, nil))
+			}
+			return true
+		})
+		r = a
+	case "map":
+		var a []interface{}
+		if n := rangeLenOf(obj); n >= 0 {
+			a = make([]interface{}, 0, n)
+		}
+		rangeEach(obj, func(el rangeElem) bool {
+			a = append(a, realValue(eval(el), nil, nil))
+			return true
+		})
+		r = a
+	case "unique":
+		r = e.unique(obj, eval)
+	}
+	return realValue(r, e.boolOpposite, e.signOpposite)
+}
+
+// find returns the index of the first element whose predicate result is @want, or -1 if not found.
+func (e *collectionFuncExprNode) find(obj interface{}, eval func(rangeElem) interface{}, want bool) int {
+	idx, i := -1, 0
+	rangeEach(obj, func(el rangeElem) bool {
+		if FakeBool(eval(el)) == want {
+			idx = i
+			return false
+		}
+		i++
+		return true
+	})
+	return idx
+}
+
+// unique reports whether the elements (or the results of the key expression) are distinct.
+func (e *collectionFuncExprNode) unique(obj interface{}, eval func(rangeElem) interface{}) bool {
+	seen := make(map[interface{}]struct{})
+	distinct := true
+	rangeEach(obj, func(el rangeElem) bool {
+		var v interface{}
+		if e.elemExprNode != nil {
+			v = eval(el)
+		} else {
+			v = realValue(rangeElemValue(el.v), nil, nil)
+		}
+		k := uniqueKey(v)
+		if _, ok := seen[k]; ok {
+			distinct = false
+			return false
+		}
+		seen[k] = struct{}{}
+		return true
+	})
+	return distinct
+}
+
+// deepKey is the key of the value which may be not comparable, see uniqueKey.
+type deepKey string
+
+// uniqueKey returns the comparable key of @v, the equal numbers have the same key.
+// NOTE:
+//
+//	The struct, array, slice, map and pointer are keyed by the values they hold instead of the addresses,
+//	so the structs with the pointer fields to the equal values are the same, see writeDeepKey.
+func uniqueKey(v interface{}) interface{} {
+	if n, ok := toNumber(v, false); ok {
+		if f, ok := n.(float64); ok && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f)
+		}
+		return n
+	}
+	if v == nil {
+		return nil
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Struct, reflect.Array, reflect.Slice, reflect.Map, reflect.Func, reflect.Ptr:
+		var b strings.Builder
+		writeDeepKey(&b, reflect.ValueOf(v), nil)
+		return deepKey(b.String())
+	}
+	return v
+}
+
+// writeDeepKey writes the key of @v into @b by the type and the value,
+// where the pointers are followed, the map entries are sorted,
+// and time.Time is keyed by the instant regardless of the location and the monotonic clock reading;
+// @path holds the pointers being written, which stops the cycles.
+func writeDeepKey(b *strings.Builder, v reflect.Value, path map[uintptr]bool) {
+	if !v.IsValid() {
+		b.WriteString("nil")
+		return
+	}
+	t := v.Type()
+	if t == timeType {
+		if tm, ok := timeValue(v); ok {
+			fmt.Fprintf(b, "time(%d.%09d)", tm.Unix(), tm.Nanosecond())
+			return
+		}
+	}
+	b.WriteString(t.PkgPath())
+	b.WriteString(t.String())
+	switch v.Kind() {
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f == 0 {
+			f = 0 // -0 == 0
+		}
+		b.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	case reflect.Complex64, reflect.Complex128:
+		fmt.Fprint(b, v.Complex())
+	case reflect.String:
+		b.WriteString(strconv.Quote(v.String()))
+	case reflect.Interface:
+		b.WriteByte('(')
+		writeDeepKey(b, v.Elem(), path)
+		b.WriteByte(')')
+	case reflect.Struct:
+		b.WriteByte('{')
+		for i := 0; i < v.NumField(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeDeepKey(b, v.Field(i), path)
+		}
+		b.WriteByte('}')
+	case reflect.Array:
+		writeDeepElems(b, v, path)
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			b.WriteString("(nil)")
+			return
+		}
+		ptr := v.Pointer()
+		if path[ptr] {
+			b.WriteString("(cycle)")
+			return
+		}
+		if path == nil {
+			path = make(map[uintptr]bool)
+		}
+		path[ptr] = true
+		defer delete(path, ptr)
+		switch v.Kind() {
+		case reflect.Ptr:
+			b.WriteByte('(')
+			writeDeepKey(b, v.Elem(), path)
+			b.WriteByte(')')
+		case reflect.Slice:
+			writeDeepElems(b, v, path)
+		default:
+			entries := make([]string, 0, v.Len())
+			iter := v.MapRange()
+			for iter.Next() {
+				var e strings.Builder
+				writeDeepKey(&e, iter.Key(), path)
+				e.WriteByte(':')
+				writeDeepKey(&e, iter.Value(), path)
+				entries = append(entries, e.String())
+			}
+			sort.Strings(entries)
+			b.WriteString("{" + strings.Join(entries, ",") + "}")
+		}
+	default:
+		// the functions, channels and unsafe pointers are only equal to themselves
+		fmt.Fprintf(b, "(%#x)", v.Pointer())
+	}
+}
+
+// writeDeepElems writes the keys of the elements of the array or slice @v, see writeDeepKey.
+func writeDeepElems(b *strings.Builder, v reflect.Value, path map[uintptr]bool) {
+	b.WriteByte('[')
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeDeepKey(b, v.Index(i), path)
+	}
+	b.WriteByte(']')
+}
+
+// timeValue returns the time.Time held by @v, which may be read from an unexported field.
+func timeValue(v reflect.Value) (time.Time, bool) {
+	if v.CanInterface() {
+		return v.Interface().(time.Time), true
+	}
+	if v.CanAddr() {
+		return *(*time.Time)(unsafe.Pointer(v.UnsafeAddr())), true
+	}
+	return time.Time{}, false
 }
@@ -1,7 +1,9 @@
 package tagexpr_test
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/bytedance/go-tagexpr/v2"
 	"github.com/stretchr/testify/assert"
@@ -32,3 +34,123 @@ func TestIssue12(t *testing.T) {
 	assert.Equal(t, []interface{}{}, r.Eval("MFs2"))
 	assert.Equal(t, true, r.EvalBool("MFs2"))
 }
+
+func TestCollectionFunc(t *testing.T) {
+	type User struct {
+		ID   int
+		Role string
+		Tags []string
+	}
+	type Item struct {
+		Qty   int
+		Price float64
+	}
+	type T struct {
+		Users  []*User         `te:"a:any($, #v.Role=='admin');b:all($, #v.ID>0);c:none($, #v.Role=='');d:unique($, #v.ID);e:count($, len(#v.Tags)>0)"`
+		Items  [][]Item        `te:"all($, count(#v, #v.Qty>0)>=1 && all(#v, #v.Price>=0))"`
+		Nums   []int           `te:"a:count($, #v>0) >= 2;b:filter($, #v%2==0);c:map($, #v*10);d:unique($);e:!any($, #v>100)"`
+		Scores map[string]int  `te:"a:filter($, #v>1);b:map($, #k+':'+sprintf('%v', #v*##));c:all($, #v>0)"`
+		Empty  []int           `te:"a:all($, #v>0);b:any($, #v>0);c:none($, #v>0);d:count($, true);e:unique($)"`
+		Nil    map[string]User `te:"a:all($, #v.ID>0);b:any($, #v.ID>0);c:filter($, true)"`
+	}
+	vm := tagexpr.New("te")
+	obj := &T{
+		Users: []*User{
+			{ID: 1, Role: "admin", Tags: []string{"x"}},
+			{ID: 2, Role: "user"},
+		},
+		Items:  [][]Item{{{Qty: 1}, {Qty: 0, Price: 1}}, {{Qty: 2, Price: 2}}},
+		Nums:   []int{1, 2, 3, 4},
+		Scores: map[string]int{"b": 2, "a": 1, "c": 3},
+		Empty:  []int{},
+	}
+	r := vm.MustRun(obj)
+	assert.Equal(t, true, r.Eval("Users@a"))
+	assert.Equal(t, true, r.Eval("Users@b"))
+	assert.Equal(t, true, r.Eval("Users@c"))
+	assert.Equal(t, true, r.Eval("Users@d"))
+	assert.Equal(t, 1.0, r.Eval("Users@e"))
+	assert.Equal(t, true, r.Eval("Items"))
+	assert.Equal(t, true, r.Eval("Nums@a"))
+	assert.Equal(t, []interface{}{2.0, 4.0}, r.Eval("Nums@b"))
+	assert.Equal(t, []interface{}{10.0, 20.0, 30.0, 40.0}, r.Eval("Nums@c"))
+	assert.Equal(t, true, r.Eval("Nums@d"))
+	assert.Equal(t, true, r.Eval("Nums@e"))
+	assert.Equal(t, []interface{}{2.0, 3.0}, r.Eval("Scores@a"))
+	assert.Equal(t, []interface{}{"a:3", "b:6", "c:9"}, r.Eval("Scores@b"))
+	assert.Equal(t, true, r.Eval("Scores@c"))
+	assert.Equal(t, true, r.Eval("Empty@a"))
+	assert.Equal(t, false, r.Eval("Empty@b"))
+	assert.Equal(t, true, r.Eval("Empty@c"))
+	assert.Equal(t, 0.0, r.Eval("Empty@d"))
+	assert.Equal(t, true, r.Eval("Empty@e"))
+	assert.Equal(t, true, r.Eval("Nil@a"))
+	assert.Equal(t, false, r.Eval("Nil@b"))
+	assert.Equal(t, []interface{}{}, r.Eval("Nil@c"))
+
+	obj.Users[1].ID = 1
+	obj.Nums = []int{0, 0, 1}
+	r = vm.MustRun(obj)
+	assert.Equal(t, false, r.Eval("Users@d"))
+	assert.Equal(t, false, r.Eval("Nums@a"))
+	assert.Equal(t, false, r.Eval("Nums@d"))
+
+	// the interface fields holding slices are not comparable
+	type Opt struct {
+		V interface{}
+	}
+	type Ref struct {
+		P *Opt
+	}
+	type Node struct {
+		Next *Node
+	}
+	cyclic := func() *Node {
+		n := &Node{}
+		n.Next = n
+		return n
+	}
+	one, another := 1, 1
+	now := time.Now()
+	p := tagexpr.MustCompile("unique((A)$)")
+	for _, c := range []struct {
+		a    []interface{}
+		want bool
+	}{
+		{[]interface{}{Opt{V: []int{1}}, Opt{V: []int{2}}}, true},
+		{[]interface{}{Opt{V: []int{1}}, Opt{V: []int{1}}}, false},
+		{[]interface{}{[1]interface{}{map[string]int{"a": 1}}, [1]interface{}{map[string]int{"a": 1}}}, false},
+		{[]interface{}{Opt{V: 1}, fmt.Sprintf("%#v", Opt{V: 1})}, true},
+		// the pointer fields are compared by the values they point to
+		{[]interface{}{Opt{V: &one}, Opt{V: &another}}, false},
+		{[]interface{}{Ref{P: &Opt{V: 1}}, Ref{P: &Opt{V: 1}}}, false},
+		{[]interface{}{Ref{P: &Opt{V: 1}}, Ref{P: &Opt{V: 2}}}, true},
+		{[]interface{}{Ref{}, Ref{P: &Opt{}}}, true},
+		{[]interface{}{cyclic(), cyclic()}, false},
+		// the times are compared by the instant
+		{[]interface{}{now, now.Round(0)}, false},
+		{[]interface{}{now, now.In(time.FixedZone("X", 3600))}, false},
+		{[]interface{}{Opt{V: now}, Opt{V: now.UTC()}}, false},
+		{[]interface{}{now, now.Add(time.Nanosecond)}, true},
+		{[]interface{}{map[string]*int{"a": &one, "b": nil}, map[string]*int{"b": nil, "a": &another}}, false},
+	} {
+		v, err := p.Eval(map[string]interface{}{"A": c.a})
+		assert.NoError(t, err)
+		assert.Equal(t, c.want, v, "%v", c.a)
+	}
+
+	// short-circuit: the predicate of any stops at the first true
+	var calls int
+	tagexpr.RegFunc("countCalls", func(args ...interface{}) interface{} {
+		calls++
+		return args[0]
+	}, true)
+	p = tagexpr.MustCompile("any((A)$, countCalls(#v>1))")
+	v, err := p.Eval(map[string]interface{}{"A": []int{1, 2, 3, 4}})
+	assert.NoError(t, err)
+	assert.Equal(t, true, v)
+	assert.Equal(t, 2, calls)
+
+	_, err = tagexpr.Compile("all($)")
+	assert.EqualError(t, err, "syntax error: all() expects 2 arguments, got 1 at offset 0\n\tall($)\n\t^")
+}
@@ -19,47 +19,198 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"unicode"
+)
+
+// The names of the selector, which select the field of the struct owning the tag,
+// the root struct or the parent struct.
+const (
+	selectorCurrent = "$"
+	selectorRoot    = "$root"
+	selectorParent  = "$parent"
 )
 
 type selectorExprNode struct {
 	exprBackground
 	field, name  string
+	up           int // the number of ../ before the field
 	subExprs     []ExprNode
 	boolOpposite *bool
 	signOpposite *bool
 }
 
 func (se *selectorExprNode) String() string {
-	return fmt.Sprintf("(%s)%s", se.field, se.name)
+	return fmt.Sprintf("(%s%s)%s", strings.Repeat("../", se.up), se.field, se.name)
+}
+
+// scoped returns whether the field is selected from an ancestor struct,
+// i.e. $root, $parent or ../.
+func (se *selectorExprNode) scoped() bool {
+	return se.up > 0 || se.name != selectorCurrent
 }
 
 func (p *Expr) readSelectorExprNode(expr *string) ExprNode {
-	field, name, subSelector, boolOpposite, signOpposite, found := findSelector(expr)
+	last := *expr
+	field, name, subSelector, tails, boolOpposite, signOpposite, found := findSelector(expr)
 	if !found {
 		return nil
 	}
 	operand := &selectorExprNode{
-		field:        field,
 		name:         name,
 		boolOpposite: boolOpposite,
 		signOpposite: signOpposite,
 	}
+	for strings.HasPrefix(field, "../") {
+		field = field[3:]
+		operand.up++
+	}
+	operand.field = field
+	if operand.up > 0 && name == selectorRoot {
+		p.setErr(p.syntaxError(last, "field without '../' for $root"))
+		return nil
+	}
 	operand.subExprs = make([]ExprNode, 0, len(subSelector))
-	for _, s := range subSelector {
-		grp := newGroupExprNode()
-		err := p.parseExprNode(&s, grp)
-		if err != nil {
+	for i, s := range subSelector {
+		sub := p.readSubscript(s, p.end-tails[i])
+		if sub == nil {
 			return nil
 		}
-		sortPriority(grp)
-		operand.subExprs = append(operand.subExprs, grp)
+		operand.subExprs = append(operand.subExprs, sub)
 	}
 	return operand
 }
 
-var selectorRegexp = regexp.MustCompile(`^([\!\+\-]*)(\([ \t]*[A-Za-z_]+[A-Za-z0-9_\.]*[ \t]*\))?(\$)([\)\[\],\+\-\*\/%><\|&!=\^ \t\\]|$)`)
+// readSubscript parses the sub-selector @s ending at the offset @end: the field of the element .Name,
+// the wildcard *, the slice lo:hi whose bounds can be omitted, or the expression of the index or key.
+func (p *Expr) readSubscript(s string, end int) ExprNode {
+	switch {
+	case s == "*":
+		return &subscriptExprNode{wildcard: true}
+	case s[0] == '.':
+		offset := end - len(s)
+		e := &stringExprNode{val: s[1:]}
+		setPos(e, offset+1)
+		setEnd(e, offset+len(s))
+		return e
+	}
+	lo, hi, ok := splitSlice(s)
+	if !ok {
+		return p.readSubExpr(s, end)
+	}
+	e := &subscriptExprNode{}
+	if strings.TrimSpace(lo) != "" {
+		bound := p.readSubExpr(lo, end-len(hi)-1)
+		if bound == nil {
+			return nil
+		}
+		e.SetLeftOperand(bound)
+	}
+	if strings.TrimSpace(hi) != "" {
+		bound := p.readSubExpr(hi, end)
+		if bound == nil {
+			return nil
+		}
+		e.SetRightOperand(bound)
+	}
+	return e
+}
+
+func (p *Expr) readSubExpr(s string, end int) ExprNode {
+	defer p.window(end)()
+	grp := newGroupExprNode()
+	err := p.parseExprNode(&s, grp)
+	if err != nil {
+		p.setErr(err)
+		return nil
+	}
+	if trimLeftSpace(&s); s != "" {
+		p.setErr(p.syntaxError(s, "operator or ']'"))
+		return nil
+	}
+	sortPriority(grp)
+	return grp
+}
+
+// bracketUnescaper removes the escape characters of the brackets in the sub-selector.
+var bracketUnescaper = strings.NewReplacer(`\[`, "[", `\]`, "]")
+
+// readSubSelector reads the sub-selector in the brackets, which can be any expression,
+// e.g. $[(Currency)$] or $[len($)-1], and the brackets in the quoted strings are not paired, e.g. $[']'].
+// NOTE:
+//
+//	The escaped brackets \[ and \] are kept for compatibility.
+func readSubSelector(expr *string) *string {
+	s := *expr
+	if len(s) == 0 || s[0] != '[' {
+		return nil
+	}
+	var depth int
+	var quoted bool
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			depth++
+		case c == ']':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			*expr = s[i+1:]
+			sub := s[1:i]
+			if strings.Contains(sub, `\[`) || strings.Contains(sub, `\]`) {
+				sub = bracketUnescaper.Replace(sub)
+			}
+			return &sub
+		}
+	}
+	return nil
+}
+
+// splitSlice splits the slice sub-selector lo:hi at the colon,
+// which is not in the quotes, the brackets or the ternary expression.
+func splitSlice(s string) (lo, hi string, ok bool) {
+	var depth, ternary int
+	var quoted bool
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted:
+			if c == '\\' {
+				i++
+			} else if c == '\'' {
+				quoted = false
+			}
+		case c == '\'':
+			quoted = true
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case depth > 0:
+		case c == '?':
+			ternary++
+		case c == ':':
+			if ternary == 0 {
+				return s[:i], s[i+1:], true
+			}
+			ternary--
+		}
+	}
+	return "", "", false
+}
+
+// subFieldRegexp the field of the element after the sub-selector, e.g. .Name of $[*].Name
+var subFieldRegexp = regexp.MustCompile(`^\.[A-Za-z_][A-Za-z0-9_]*`)
+
+var selectorRegexp = regexp.MustCompile(`^([\!\+\-]*)(\([ \t]*(?:\.\./)*[A-Za-z_]+[A-Za-z0-9_\.]*[ \t]*\))?(\$root|\$parent|\$)([\)\[\],\+\-\*\/%><\|&!=\^\?;: \t\\]|$)`)
 
-func findSelector(expr *string) (field string, name string, subSelector []string, boolOpposite, signOpposite *bool, found bool) {
+// findSelector finds the selector at the beginning of @expr,
+// and @tails are the lengths of @expr after the sub-selectors, which locate them.
+func findSelector(expr *string) (field string, name string, subSelector []string, tails []int, boolOpposite, signOpposite *bool, found bool) {
 	raw := *expr
 	a := selectorRegexp.FindAllStringSubmatch(raw, -1)
 	if len(a) != 1 {
@@ -72,15 +223,27 @@ func findSelector(expr *string) (field string, name string, subSelector []string
 	name = r[3]
 	*expr = (*expr)[len(a[0][0])-len(r[4]):]
 	for {
-		sub := readPairedSymbol(expr, '[', ']')
+		sub := readSubSelector(expr)
 		if sub == nil {
+			// .Name is the same as ['Name'] after the sub-selector
+			if len(subSelector) > 0 {
+				if f := subFieldRegexp.FindString(*expr); f != "" {
+					subSelector = append(subSelector, f)
+					*expr = (*expr)[len(f):]
+					tails = append(tails, len(*expr))
+					continue
+				}
+			}
 			break
 		}
 		if *sub == "" || (*sub)[0] == '[' {
 			*expr = raw
-			return "", "", nil, nil, nil, false
+			return "", "", nil, nil, nil, nil, false
 		}
-		subSelector = append(subSelector, strings.TrimSpace(*sub))
+		trimmed := strings.TrimRightFunc(*sub, unicode.IsSpace)
+		subSelector = append(subSelector, strings.TrimLeftFunc(trimmed, unicode.IsSpace))
+		// skip the trailing spaces and the closing bracket
+		tails = append(tails, len(*expr)+1+len(*sub)-len(trimmed))
 	}
 	prefix := r[1]
 	if len(prefix) == 0 {
@@ -100,10 +263,60 @@ func (se *selectorExprNode) Run(ctx context.Context, currField string, tagExpr *
 			subFields[i] = e.Run(ctx, currField, tagExpr)
 		}
 	}
+	return se.value(currField, tagExpr, subFields)
+}
+
+// value returns the selected value with the subscript values @subFields.
+func (se *selectorExprNode) value(currField string, tagExpr *TagExpr, subFields []interface{}) interface{} {
 	field := se.field
-	if field == "" {
+	if se.scoped() {
+		up := se.up
+		if se.name == selectorParent {
+			up++
+		}
+		tagExpr = tagExpr.ancestor(up, se.name == selectorRoot)
+		if tagExpr == nil {
+			return nil
+		}
+	} else if field == "" {
 		field = currField
 	}
 	v := tagExpr.getValue(field, subFields)
 	return realValue(v, se.boolOpposite, se.signOpposite)
 }
+
+// subscriptExprNode the slice sub-selector [lo:hi] or the wildcard [*] of the selector,
+// whose bounds are the left and right operands, nil if omitted.
+type subscriptExprNode struct {
+	exprBackground
+	wildcard bool
+}
+
+func (se *subscriptExprNode) String() string {
+	if se.wildcard {
+		return "*"
+	}
+	return ":"
+}
+
+func (se *subscriptExprNode) Run(ctx context.Context, currField string, tagExpr *TagExpr) interface{} {
+	if se.wildcard {
+		return wildcardSub{}
+	}
+	var r sliceSub
+	if lo := se.LeftOperand(); lo != nil {
+		r.lo = lo.Run(ctx, currField, tagExpr)
+	}
+	if hi := se.RightOperand(); hi != nil {
+		r.hi = hi.Run(ctx, currField, tagExpr)
+	}
+	return r
+}
+
+// wildcardSub the value of the sub-selector [*].
+type wildcardSub struct{}
+
+// sliceSub the value of the sub-selector [lo:hi], the nil bound is omitted.
+type sliceSub struct {
+	lo, hi interface{}
+}
@@ -0,0 +1,221 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// --------------------------- String function ---------------------------
+
+// stringArgs converts the first @n arguments to String, and returns false if any of them is not a string.
+func stringArgs(args []interface{}, n int) ([]string, bool) {
+	if len(args) < n {
+		return nil, false
+	}
+	a := make([]string, n)
+	for i := 0; i < n; i++ {
+		s, ok := toString(args[i], false)
+		if !ok {
+			return nil, false
+		}
+		a[i] = s
+	}
+	return a, true
+}
+
+// intArg converts the argument to int, and returns false if it is not a number.
+func intArg(v interface{}) (int, bool) {
+	f, ok := toFloat64(v, false)
+	return int(f), ok
+}
+
+// strings2Sig the signature of the string predicate with two string arguments
+var strings2Sig = FuncSignature{In: []Kind{StringKind, StringKind}, Out: BoolKind, Pure: true}
+
+func init() {
+	// contains: whether the string contains the substring, e.g. contains($, 'abc')
+	regBuiltinFuncSig("contains", strings2Sig, func(args ...interface{}) interface{} {
+		a, ok := stringArgs(args, 2)
+		return Boolean(ok && strings.Contains(a[0], a[1]))
+	})
+	// hasPrefix: whether the string begins with the prefix
+	regBuiltinFuncSig("hasPrefix", strings2Sig, func(args ...interface{}) interface{} {
+		a, ok := stringArgs(args, 2)
+		return Boolean(ok && strings.HasPrefix(a[0], a[1]))
+	})
+	// hasSuffix: whether the string ends with the suffix
+	regBuiltinFuncSig("hasSuffix", strings2Sig, func(args ...interface{}) interface{} {
+		a, ok := stringArgs(args, 2)
+		return Boolean(ok && strings.HasSuffix(a[0], a[1]))
+	})
+	// lower: the string with all Unicode letters mapped to their lower case
+	regBuiltinFuncSig("lower", FuncSignature{In: []Kind{StringKind}, Out: StringKind, Pure: true}, func(args ...interface{}) interface{} {
+		a, ok := stringArgs(args, 1)
+		if !ok {
+			return nil
+		}
+		return String(strings.ToLower(a[0]))
+	})
+	// upper: the string with all Unicode letters mapped to their upper case
+	regBuiltinFuncSig("upper", FuncSignature{In: []Kind{StringKind}, Out: StringKind, Pure: true}, func(args ...interface{}) interface{} {
+		a, ok := stringArgs(args, 1)
+		if !ok {
+			return nil
+		}
+		return String(strings.ToUpper(a[0]))
+	})
+	// trim: trim the leading and trailing white space, or the characters in the cutset, e.g. trim($) or trim($, '-_')
+	regBuiltinFuncSig("trim", FuncSignature{In: []Kind{StringKind, StringKind}, Optional: 1, Out: StringKind, Pure: true}, func(args ...interface{}) interface{} {
+		switch len(args) {
+		case 1:
+			if a, ok := stringArgs(args, 1); ok {
+				return String(strings.TrimSpace(a[0]))
+			}
+		case 2:
+			if a, ok := stringArgs(args, 2); ok {
+				return String(strings.Trim(a[0], a[1]))
+			}
+		}
+		return nil
+	})
+	// split: split the string by the separator, e.g. split($, ',')
+	regBuiltinFuncSig("split", FuncSignature{In: []Kind{StringKind, StringKind}, Out: ListKind, Pure: true}, func(args ...interface{}) interface{} {
+		a, ok := stringArgs(args, 2)
+		if !ok || len(args) != 2 {
+			return nil
+		}
+		ss := strings.Split(a[0], a[1])
+		r := make([]interface{}, len(ss))
+		for i, s := range ss {
+			r[i] = String(s)
+		}
+		return r
+	})
+	// join: join the elements of array or slice by the separator, e.g. join($, ',')
+	regBuiltinFuncSig("join", FuncSignature{In: []Kind{ListKind, StringKind}, Out: StringKind, Pure: true}, func(args ...interface{}) interface{} {
+		if len(args) != 2 {
+			return nil
+		}
+		sep, ok := toString(args[1], false)
+		if !ok {
+			return nil
+		}
+		v := reflect.ValueOf(args[0])
+		switch v.Kind() {
+		case reflect.Array, reflect.Slice:
+		default:
+			return nil
+		}
+		ss := make([]string, v.Len())
+		for i := range ss {
+			ss[i], _ = toString(realValue(rangeElemValue(v.Index(i)), nil, nil), true)
+		}
+		return String(strings.Join(ss, sep))
+	})
+	// replace: replace the first n (all if n is omitted) old substrings with new, e.g. replace($, 'a', 'b') or replace($, 'a', 'b', 1)
+	regBuiltinFuncSig("replace", FuncSignature{In: []Kind{StringKind, StringKind, StringKind, NumberKind}, Optional: 1, Out: StringKind, Pure: true}, func(args ...interface{}) interface{} {
+		a, ok := stringArgs(args, 3)
+		if !ok {
+			return nil
+		}
+		n := -1
+		switch len(args) {
+		case 3:
+		case 4:
+			if n, ok = intArg(args[3]); !ok {
+				return nil
+			}
+		default:
+			return nil
+		}
+		return String(strings.Replace(a[0], a[1], a[2], n))
+	})
+	// indexOf: the character(rune) index of the first substring, or -1 if not found
+	regBuiltinFuncSig("indexOf", FuncSignature{In: []Kind{StringKind, StringKind}, Out: NumberKind, Pure: true}, func(args ...interface{}) interface{} {
+		a, ok := stringArgs(args, 2)
+		if !ok {
+			return Number(-1)
+		}
+		i := strings.Index(a[0], a[1])
+		if i < 0 {
+			return Number(-1)
+		}
+		return Number(utf8.RuneCountInString(a[0][:i]))
+	})
+	// substr: the substring from the character(rune) index start with the length (to the end if omitted),
+	// e.g. substr($, 1) or substr($, 1, 3)
+	regBuiltinFuncSig("substr", FuncSignature{In: []Kind{StringKind, NumberKind, NumberKind}, Optional: 1, Out: StringKind, Pure: true}, func(args ...interface{}) interface{} {
+		a, ok := stringArgs(args, 1)
+		if !ok || len(args) < 2 || len(args) > 3 {
+			return nil
+		}
+		runes := []rune(a[0])
+		start, ok := intArg(args[1])
+		if !ok {
+			return nil
+		}
+		if start < 0 {
+			start = 0
+		} else if start > len(runes) {
+			start = len(runes)
+		}
+		end := len(runes)
+		if len(args) == 3 {
+			length, ok := intArg(args[2])
+			if !ok {
+				return nil
+			}
+			if length < 0 {
+				length = 0
+			}
+			if start+length < end {
+				end = start + length
+			}
+		}
+		return String(runes[start:end])
+	})
+	// matches: whether the string matches the regular expression,
+	// the constant expression is compiled when the expression is parsed, e.g. matches($, '^\\d+$')
+	sig := strings2Sig
+	regBuiltinFunc("matches", newFuncReader("matches", funcExprNode{fn: matches, sig: &sig, regexpArg: 2}))
+}
+
+// matches returns whether the string matches the regular expression,
+// which is *regexp.Regexp if it is constant, otherwise it is compiled on every call.
+func matches(args ...interface{}) interface{} {
+	if len(args) != 2 {
+		return false
+	}
+	s, ok := toString(args[0], false)
+	if !ok {
+		return false
+	}
+	re, ok := args[1].(*regexp.Regexp)
+	if !ok {
+		pattern, ok := toString(args[1], false)
+		if !ok {
+			return false
+		}
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return false
+		}
+	}
+	return Boolean(re.MatchString(s))
+}
@@ -71,15 +71,17 @@ func TestReadBoolExprNode(t *testing.T) {
 func TestReadDigitalExprNode(t *testing.T) {
 	var cases = []struct {
 		expr         string
-		val          float64
+		val          interface{}
 		lastExprNode string
 	}{
 		{expr: "0.1 +1", val: 0.1, lastExprNode: " +1"},
-		{expr: "-1\\1", val: -1, lastExprNode: "\\1"},
+		{expr: "-1\\1", val: int64(-1), lastExprNode: "\\1"},
 		{expr: "1a", val: 0, lastExprNode: ""},
-		{expr: "1", val: 1, lastExprNode: ""},
+		{expr: "1", val: int64(1), lastExprNode: ""},
 		{expr: "1.1", val: 1.1, lastExprNode: ""},
 		{expr: "1.1/", val: 1.1, lastExprNode: "/"},
+		{expr: "9007199254740993", val: int64(9007199254740993), lastExprNode: ""},
+		{expr: "18446744073709551615", val: uint64(18446744073709551615), lastExprNode: ""},
 	}
 	for _, c := range cases {
 		expr := c.expr
@@ -90,9 +92,9 @@ func TestReadDigitalExprNode(t *testing.T) {
 			}
 			continue
 		}
-		got := e.Run(context.TODO(), "", nil).(float64)
+		got := e.Run(context.TODO(), "", nil)
 		if got != c.val || expr != c.lastExprNode {
-			t.Fatalf("expr: %s, got: %f, %s, want: %f, %s", c.expr, got, expr, c.val, c.lastExprNode)
+			t.Fatalf("expr: %s, got: %v, %s, want: %v, %s", c.expr, got, expr, c.val, c.lastExprNode)
 		}
 	}
 }
@@ -134,10 +136,25 @@ func TestFindSelector(t *testing.T) {
 		{expr: "$[[[]]]", last: "$[[[]]]"},
 		{expr: "$[(A)$[1]]", name: "$", subSelector: []string{"(A)$[1]"}, found: true},
 		{expr: "$>0&&$<10", name: "$", found: true, last: ">0&&$<10"},
+		{expr: "(../A)$", field: "../A", name: "$", found: true},
+		{expr: "(../../A.B)$[0]", field: "../../A.B", name: "$", subSelector: []string{"0"}, found: true},
+		{expr: "$root", name: "$root", found: true},
+		{expr: "!(A)$parent>0", field: "A", name: "$parent", boolOpposite: true, found: true, last: ">0"},
+		{expr: "(A)$root[1]", field: "A", name: "$root", subSelector: []string{"1"}, found: true},
+		{expr: "$rooty", last: "$rooty"},
+		{expr: "$[*].Name", name: "$", subSelector: []string{"*", ".Name"}, found: true},
+		{expr: "(A)$[1:3][0].B_1>0", field: "A", name: "$", subSelector: []string{"1:3", "0", ".B_1"}, found: true, last: ">0"},
+		{expr: "$[-1].5", name: "$", subSelector: []string{"-1"}, found: true, last: ".5"},
+		{expr: "(A)$[']'][(B)$]", field: "A", name: "$", subSelector: []string{"']'", "(B)$"}, found: true},
+		{expr: "$['\\'[']&&x", name: "$", subSelector: []string{"'\\'['"}, found: true, last: "&&x"},
+		{expr: "$[len($[0])-1]", name: "$", subSelector: []string{"len($[0])-1"}, found: true},
+		{expr: "$[\\]]", name: "$", subSelector: []string{"]"}, found: true},
+		{expr: "$[']", name: "$", found: true, last: "[']"},
+		{expr: "(..A)$", last: "(..A)$"},
 	}
 	for _, c := range cases {
 		last := c.expr
-		field, name, subSelector, boolOpposite, signOpposite, found := findSelector(&last)
+		field, name, subSelector, _, boolOpposite, signOpposite, found := findSelector(&last)
 		if found != c.found {
 			t.Fatalf("%q found: got: %v, want: %v", c.expr, found, c.found)
 		}
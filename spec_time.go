@@ -0,0 +1,254 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr
+
+import (
+	"reflect"
+	"time"
+)
+
+// --------------------------- Time ---------------------------
+//
+// The time.Time and time.Duration values are kept in the expression:
+//
+//	time op time: comparison, time - time is time.Duration;
+//	time +/- duration: time.Time;
+//	duration op duration: comparison and arithmetic, the result is time.Duration;
+//	the string is parsed as time (RFC3339) or duration ('30m') when compared with them.
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// timeLayouts the layouts tried in turn when parsing string to time.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// toTime converts time.Time, *time.Time or time string to time.Time.
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t != nil {
+			return *t, true
+		}
+	case string:
+		return parseTime(t)
+	}
+	return time.Time{}, false
+}
+
+// toDuration converts time.Duration, duration string or integer(nanoseconds) to time.Duration.
+func toDuration(v interface{}) (time.Duration, bool) {
+	switch t := v.(type) {
+	case time.Duration:
+		return t, true
+	case string:
+		d, err := time.ParseDuration(t)
+		return d, err == nil
+	}
+	n, ok := toNumber(v, false)
+	if !ok {
+		return 0, false
+	}
+	switch i := n.(type) {
+	case int64:
+		return time.Duration(i), true
+	case float64:
+		return time.Duration(i), true
+	}
+	return 0, false
+}
+
+func isTimeValue(v interface{}) bool {
+	switch v.(type) {
+	case time.Time, time.Duration:
+		return true
+	}
+	return false
+}
+
+// addTime returns @v0+@v1 if one of them is time.Time or time.Duration.
+func addTime(v0, v1 interface{}) (interface{}, bool) {
+	if !isTimeValue(v0) {
+		if !isTimeValue(v1) {
+			return nil, false
+		}
+		v0, v1 = v1, v0
+	}
+	switch t := v0.(type) {
+	case time.Time:
+		if d, ok := toDuration(v1); ok {
+			return t.Add(d), true
+		}
+	case time.Duration:
+		if t1, ok := v1.(time.Time); ok {
+			return t1.Add(t), true
+		}
+		if d, ok := toDuration(v1); ok {
+			return durationResult(addNumber(int64(t), int64(d))), true
+		}
+	}
+	return nil, false
+}
+
+// subTime returns @v0-@v1 if @v0 is time.Time or time.Duration.
+func subTime(v0, v1 interface{}) (interface{}, bool) {
+	switch t := v0.(type) {
+	case time.Time:
+		if t1, ok := v1.(time.Time); ok {
+			return t.Sub(t1), true
+		}
+		if d, ok := toDuration(v1); ok {
+			return t.Add(-d), true
+		}
+	case time.Duration:
+		if d, ok := toDuration(v1); ok {
+			return durationResult(subNumber(int64(t), int64(d))), true
+		}
+	}
+	return nil, false
+}
+
+func durationResult(n interface{}) interface{} {
+	if i, ok := n.(int64); ok {
+		return time.Duration(i)
+	}
+	return n
+}
+
+// compareTime compares @v0 with @v1 if one of them is time.Time or time.Duration.
+func compareTime(v0, v1 interface{}) (int, bool) {
+	if !isTimeValue(v0) {
+		if !isTimeValue(v1) {
+			return 0, false
+		}
+		c, ok := compareTime(v1, v0)
+		return -c, ok
+	}
+	switch t := v0.(type) {
+	case time.Time:
+		t1, ok := toTime(v1)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case t.Before(t1):
+			return -1, true
+		case t.After(t1):
+			return 1, true
+		}
+		return 0, true
+	case time.Duration:
+		d, ok := toDuration(v1)
+		if !ok {
+			return 0, false
+		}
+		return compareInt64(int64(t), int64(d)), true
+	}
+	return 0, false
+}
+
+// timesSig the signature of the time predicate with two time arguments
+var timesSig = FuncSignature{In: []Kind{TimeKind | StringKind, TimeKind | StringKind}, Out: BoolKind, Pure: true}
+
+func init() {
+	// now: the current local time
+	regBuiltinFuncSig("now", FuncSignature{Out: TimeKind}, func(args ...interface{}) interface{} {
+		return time.Now()
+	})
+	// duration: parse duration string, e.g. duration('1h30m'), or integer nanoseconds
+	regBuiltinFuncSig("duration", FuncSignature{In: []Kind{DurationKind | StringKind | NumberKind}, Out: DurationKind, Pure: true}, func(args ...interface{}) interface{} {
+		if len(args) != 1 {
+			return nil
+		}
+		if d, ok := toDuration(args[0]); ok {
+			return d
+		}
+		return nil
+	})
+	// date: date('2006-01-02'), date('01/02/2006', '01/02/2006') or date(year, month, day[, hour, min, sec]) in UTC
+	regBuiltinFuncSig("date", FuncSignature{In: []Kind{AnyKind, AnyKind, NumberKind, NumberKind, NumberKind, NumberKind}, Optional: 5, Out: TimeKind, Pure: true}, func(args ...interface{}) interface{} {
+		switch len(args) {
+		case 1:
+			if t, ok := toTime(args[0]); ok {
+				return t
+			}
+		case 2:
+			s, ok0 := args[0].(string)
+			layout, ok1 := args[1].(string)
+			if ok0 && ok1 {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t
+				}
+			}
+		case 3, 4, 5, 6:
+			var a [6]int
+			for i, arg := range args {
+				f, ok := toFloat64(arg, false)
+				if !ok {
+					return nil
+				}
+				a[i] = int(f)
+			}
+			return time.Date(a[0], time.Month(a[1]), a[2], a[3], a[4], a[5], 0, time.UTC)
+		}
+		return nil
+	})
+	// before: whether the first time is before the second one
+	regBuiltinFuncSig("before", timesSig, func(args ...interface{}) interface{} {
+		if len(args) != 2 {
+			return false
+		}
+		t0, ok0 := toTime(args[0])
+		t1, ok1 := toTime(args[1])
+		return ok0 && ok1 && t0.Before(t1)
+	})
+	// after: whether the first time is after the second one
+	regBuiltinFuncSig("after", timesSig, func(args ...interface{}) interface{} {
+		if len(args) != 2 {
+			return false
+		}
+		t0, ok0 := toTime(args[0])
+		t1, ok1 := toTime(args[1])
+		return ok0 && ok1 && t0.After(t1)
+	})
+	// add: add the duration to the time, e.g. add((StartAt)$, '720h')
+	regBuiltinFuncSig("add", FuncSignature{In: []Kind{TimeKind | StringKind, DurationKind | StringKind | NumberKind}, Out: TimeKind, Pure: true}, func(args ...interface{}) interface{} {
+		if len(args) != 2 {
+			return nil
+		}
+		t, ok0 := toTime(args[0])
+		d, ok1 := toDuration(args[1])
+		if !ok0 || !ok1 {
+			return nil
+		}
+		return t.Add(d)
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Bytedance Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tagexpr_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bytedance/go-tagexpr/v2"
+)
+
+func TestTime(t *testing.T) {
+	type Schedule struct {
+		StartAt  time.Time     `te:"$ > date('2020-01-01') && $ < date(2030, 1, 1)"`
+		EndAt    *time.Time    `te:"$ > (StartAt)$ && $ <= (StartAt)$ + duration('720h')"`
+		Timeout  time.Duration `te:"$ >= '30s' && $ < duration('1h') && $ + '30m' == '1h'"`
+		Interval time.Duration `te:"$"`
+		Expire   time.Time     `te:"$ > now()"`
+		Sub      time.Time     `te:"a:(EndAt)$ - $;b:after((EndAt)$, $) && before($, (EndAt)$);c:add($, '24h') == (EndAt)$;d:$ == '2024-05-01T00:00:00Z'"`
+		Days     []time.Time   `te:"$[0] < $[1] && -(Timeout)$ < 0"`
+	}
+	vm := tagexpr.New("te")
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	s := &Schedule{
+		StartAt:  start,
+		EndAt:    &end,
+		Timeout:  30 * time.Minute,
+		Interval: time.Second,
+		Expire:   time.Now().Add(time.Hour),
+		Sub:      start,
+		Days:     []time.Time{start, end},
+	}
+	te := vm.MustRun(s)
+	assert.Equal(t, true, te.Eval("StartAt"))
+	assert.Equal(t, true, te.Eval("EndAt"))
+	assert.Equal(t, true, te.Eval("Timeout"))
+	assert.Equal(t, time.Second, te.Eval("Interval"))
+	assert.Equal(t, true, te.Eval("Expire"))
+	assert.Equal(t, 24*time.Hour, te.Eval("Sub@a"))
+	assert.Equal(t, true, te.Eval("Sub@b"))
+	assert.Equal(t, true, te.Eval("Sub@c"))
+	assert.Equal(t, true, te.Eval("Sub@d"))
+	assert.Equal(t, true, te.Eval("Days"))
+
+	end = start.Add(721 * time.Hour)
+	s.Timeout = time.Hour
+	s.Expire = time.Now().Add(-time.Hour)
+	te = vm.MustRun(s)
+	assert.Equal(t, false, te.Eval("EndAt"))
+	assert.Equal(t, false, te.Eval("Timeout"))
+	assert.Equal(t, false, te.Eval("Expire"))
+
+	p := tagexpr.MustCompile("(At)$ - duration('1h') == date('2024-05-02 00:00:00')")
+	v, err := p.Eval(map[string]interface{}{"At": end.Add(-696 * time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, true, v)
+}
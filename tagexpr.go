@@ -16,12 +16,15 @@
 package tagexpr
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unsafe"
 
 	"github.com/andeya/ameda"
@@ -39,6 +42,9 @@ type (
 type VM struct {
 	tagName   string
 	structJar map[uintptr]*structVM
+	funcs     map[string]func(p *Expr, expr *string) ExprNode // registered by VM.RegFunc, shadow the global functions
+	env       map[string]EnvVar                               // declared by VM.DeclareEnv
+	envNames  []string                                        // the sorted names of env
 	rw        sync.RWMutex
 }
 
@@ -46,11 +52,14 @@ type VM struct {
 type structVM struct {
 	vm                         *VM
 	name                       string
+	typ                        reflect.Type
 	fields                     map[string]*fieldVM
 	fieldSelectorList          []string
 	fieldsWithIndirectStructVM []*fieldVM
 	exprs                      map[string]*Expr
-	exprSelectorList           []string
+	exprSelectorList           []string // in the declared order
+	exprPriorities             []int    // the priorities of exprSelectorList
+	exprRangeOrder             []int    // the indexes of exprSelectorList in the range order
 	ifaceTagExprGetters        []func(unsafe.Pointer, string, func(*TagExpr, error) error) error
 	err                        error
 }
@@ -65,6 +74,8 @@ type fieldVM struct {
 	valueGetter            func(unsafe.Pointer) interface{}
 	reflectValueGetter     func(unsafe.Pointer, bool) reflect.Value
 	exprs                  map[string]*Expr
+	exprSelectorList       []string // in the declared order
+	priority               int
 	origin                 *structVM
 	mapKeyStructVM         *structVM
 	mapOrSliceElemStructVM *structVM
@@ -285,10 +296,12 @@ func (vm *VM) registerStructLocked(structType reflect.Type) (*structVM, error) {
 	}
 	s = vm.newStructVM()
 	s.name = structType.String()
+	s.typ = structType
 	vm.structJar[tid] = s
 	var numField = structType.NumField()
 	var structField reflect.StructField
 	var sub *structVM
+	var fields = make([]*fieldVM, 0, numField)
 	for i := 0; i < numField; i++ {
 		structField = structType.Field(i)
 		field, ok, err := s.newFieldVM(structField)
@@ -300,9 +313,13 @@ func (vm *VM) registerStructLocked(structType reflect.Type) (*structVM, error) {
 		if !ok {
 			continue
 		}
+		fields = append(fields, field)
 		switch field.elemKind {
 		default:
 			field.setUnsupportGetter()
+			if field.elemType == timeType {
+				break
+			}
 			switch field.elemKind {
 			case reflect.Struct:
 				sub, err = vm.registerStructLocked(field.structField.Type)
@@ -317,7 +334,11 @@ func (vm *VM) registerStructLocked(structType reflect.Type) (*structVM, error) {
 		case reflect.Float32, reflect.Float64,
 			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-			field.setFloatGetter()
+			if field.elemType == durationType {
+				field.setDurationGetter()
+				break
+			}
+			field.setNumberGetter()
 		case reflect.String:
 			field.setStringGetter()
 		case reflect.Bool:
@@ -330,9 +351,41 @@ func (vm *VM) registerStructLocked(structType reflect.Type) (*structVM, error) {
 			}
 		}
 	}
+	// the field kinds are known after all fields are registered
+	if err = s.checkKinds(fields); err != nil {
+		s.err = err
+		return nil, err
+	}
+	// the field selectors can be resolved after all fields are registered
+	for _, field := range fields {
+		for _, expr := range field.exprs {
+			expr.compile(s, field.structField.Name)
+		}
+	}
+	s.sortExprs()
 	return s, nil
 }
 
+// addExpr adds the expression in the declared order.
+func (s *structVM) addExpr(exprSelector string, expr *Expr, priority int) {
+	s.exprs[exprSelector] = expr
+	s.exprSelectorList = append(s.exprSelectorList, exprSelector)
+	s.exprPriorities = append(s.exprPriorities, priority)
+}
+
+// sortExprs sorts the range order of the expressions by the priority from high to low,
+// and the expressions with the same priority are kept in the declared order.
+func (s *structVM) sortExprs() {
+	order := make([]int, len(s.exprSelectorList))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return s.exprPriorities[order[i]] > s.exprPriorities[order[j]]
+	})
+	s.exprRangeOrder = order
+}
+
 func (vm *VM) registerIndirectStructLocked(field *fieldVM) error {
 	field.setLengthGetter()
 	if field.tagOp == tagOmit {
@@ -525,6 +578,7 @@ func (s *structVM) newChildField(parent *fieldVM, child *fieldVM, toBind bool) *
 	f := &fieldVM{
 		structField:            child.structField,
 		exprs:                  make(map[string]*Expr, len(child.exprs)),
+		priority:               child.priority,
 		ptrDeep:                child.ptrDeep,
 		elemType:               child.elemType,
 		elemKind:               child.elemKind,
@@ -585,11 +639,12 @@ func (s *structVM) newChildField(parent *fieldVM, child *fieldVM, toBind bool) *
 		s.fields[f.fieldSelector] = f
 		s.fieldSelectorList = append(s.fieldSelectorList, f.fieldSelector)
 		if parent.tagOp != tagOmit {
-			for k, v := range child.exprs {
+			for _, k := range child.exprSelectorList {
 				selector := parent.fieldSelector + FieldSeparator + k
+				v := child.exprs[k]
 				f.exprs[selector] = v
-				s.exprs[selector] = v
-				s.exprSelectorList = append(s.exprSelectorList, selector)
+				f.exprSelectorList = append(f.exprSelectorList, selector)
+				s.addExpr(selector, v, child.priority)
 			}
 		}
 	}
@@ -631,20 +686,40 @@ func (s *structVM) setIfaceTagExprGetter(f *fieldVM) {
 	})
 }
 
-func (f *fieldVM) setFloatGetter() {
+func (f *fieldVM) setNumberGetter() {
 	if f.ptrDeep == 0 {
 		f.valueGetter = func(ptr unsafe.Pointer) interface{} {
 			ptr = f.getPtr(ptr)
 			if ptr == nil {
 				return nil
 			}
-			return getFloat64(f.elemKind, ptr)
+			return getNumber(f.elemKind, ptr)
 		}
 	} else {
 		f.valueGetter = func(ptr unsafe.Pointer) interface{} {
 			v := f.packElemFrom(ptr)
 			if v.CanAddr() {
-				return getFloat64(f.elemKind, unsafe.Pointer(v.UnsafeAddr()))
+				return getNumber(f.elemKind, unsafe.Pointer(v.UnsafeAddr()))
+			}
+			return nil
+		}
+	}
+}
+
+func (f *fieldVM) setDurationGetter() {
+	if f.ptrDeep == 0 {
+		f.valueGetter = func(ptr unsafe.Pointer) interface{} {
+			ptr = f.getPtr(ptr)
+			if ptr == nil {
+				return nil
+			}
+			return *(*time.Duration)(ptr)
+		}
+	} else {
+		f.valueGetter = func(ptr unsafe.Pointer) interface{} {
+			v := f.packElemFrom(ptr)
+			if v.IsValid() {
+				return time.Duration(v.Int())
 			}
 			return nil
 		}
@@ -741,10 +816,12 @@ func (s *structVM) newTagExpr(ptr unsafe.Pointer, path string) *TagExpr {
 
 // TagExpr struct tag expression evaluator
 type TagExpr struct {
-	s    *structVM
-	ptr  unsafe.Pointer
-	sub  map[string]*TagExpr
-	path string
+	s      *structVM
+	ptr    unsafe.Pointer
+	sub    map[string]*TagExpr
+	path   string
+	data   reflect.Value // non-struct data evaluated by Program
+	parent *TagExpr      // the enclosing struct, selected by $parent; nil for the root
 }
 
 // EvalFloat evaluates the value of the struct tag expression by the selector expression.
@@ -804,6 +881,10 @@ func FakeBool(v interface{}) bool {
 		return r != ""
 	case bool:
 		return r
+	case time.Duration:
+		return r != 0
+	case time.Time:
+		return !r.IsZero()
 	case nil, error:
 		return false
 	case []interface{}:
@@ -848,9 +929,48 @@ func (t *TagExpr) RangeFields(fn func(*FieldHandler) bool) bool {
 // NOTE:
 //
 //	format: fieldName, fieldName.exprName, fieldName1.fieldName2.exprName1
-//	result types: float64, string, bool, nil
+//	result types: float64, string, bool, time.Time, time.Duration, nil
 func (t *TagExpr) Eval(exprSelector string) interface{} {
-	expr, ok := t.s.exprs[exprSelector]
+	return t.EvalContext(context.Background(), exprSelector)
+}
+
+// EvalContext evaluates the value of the struct tag expression by the selector expression with the context,
+// which is passed to the functions registered by RegFuncCtx.
+// NOTE:
+//
+//	format: fieldName, fieldName.exprName, fieldName1.fieldName2.exprName1
+//	result types: float64, string, bool, time.Time, time.Duration, nil
+func (t *TagExpr) EvalContext(ctx context.Context, exprSelector string) interface{} {
+	expr, base, targetTagExpr, ok := t.lookupExpr(exprSelector)
+	if !ok {
+		return nil
+	}
+	return expr.runContext(ctx, base, targetTagExpr)
+}
+
+// Explain evaluates the struct tag expression by the selector expression,
+// and returns the evaluated expression tree, which shows the value of every sub-expression.
+// NOTE:
+//
+//	format: fieldName, fieldName.exprName, fieldName1.fieldName2.exprName1
+//	If the expression is not found, return nil.
+func (t *TagExpr) Explain(exprSelector string) *Explanation {
+	return t.ExplainContext(context.Background(), exprSelector)
+}
+
+// ExplainContext is similar to Explain, but with the context,
+// which is passed to the functions registered by RegFuncCtx.
+func (t *TagExpr) ExplainContext(ctx context.Context, exprSelector string) *Explanation {
+	expr, base, targetTagExpr, ok := t.lookupExpr(exprSelector)
+	if !ok {
+		return nil
+	}
+	return expr.explain(ctx, base, targetTagExpr)
+}
+
+// lookupExpr returns the expression of the selector, with its name and the *TagExpr it runs on.
+func (t *TagExpr) lookupExpr(exprSelector string) (expr *Expr, base string, targetTagExpr *TagExpr, ok bool) {
+	expr, ok = t.s.exprs[exprSelector]
 	if !ok {
 		// Compatible with single mode or the expression with the name @
 		if strings.HasSuffix(exprSelector, ExprNameSeparator) {
@@ -861,22 +981,22 @@ func (t *TagExpr) Eval(exprSelector string) interface{} {
 			expr, ok = t.s.exprs[exprSelector]
 		}
 		if !ok {
-			return nil
+			return
 		}
 	}
 	dir, base := splitFieldSelector(exprSelector)
 	targetTagExpr, err := t.checkout(dir)
 	if err != nil {
-		return nil
+		return nil, "", nil, false
 	}
-	return expr.run(base, targetTagExpr)
+	return expr, base, targetTagExpr, true
 }
 
 // EvalWithEnv evaluates the value with the given env
 // NOTE:
 //
 //	format: fieldName, fieldName.exprName, fieldName1.fieldName2.exprName1
-//	result types: float64, string, bool, nil
+//	result types: float64, string, bool, time.Time, time.Duration, nil
 func (t *TagExpr) EvalWithEnv(exprSelector string, env map[string]interface{})interface{} {
 	expr, ok := t.s.exprs[exprSelector]
 	if !ok {
@@ -897,6 +1017,10 @@ func (t *TagExpr) EvalWithEnv(exprSelector string, env map[string]interface{})in
 	if err != nil {
 		return nil
 	}
+	env, err = t.s.vm.convertEnv(env)
+	if err != nil {
+		return err
+	}
 	return expr.runWithEnv(base, targetTagExpr, env)
 }
 
@@ -904,17 +1028,21 @@ func (t *TagExpr) EvalWithEnv(exprSelector string, env map[string]interface{})in
 // When fn returns false, interrupt traversal and return false.
 // NOTE:
 //
-//	eval result types: float64, string, bool, nil
+//	eval result types: float64, string, bool, time.Time, time.Duration, nil
+//	The expressions of the struct are ranged by the priority from high to low, and then in the declared order,
+//	i.e. the order of the fields and the order in the tag, see PriorityName;
+//	The structs in the slice, array, map and interface fields are ranged after them.
 func (t *TagExpr) Range(fn func(*ExprHandler) error) error {
 	var err error
 	if list := t.s.exprSelectorList; len(list) > 0 {
-		for _, es := range list {
+		for _, i := range t.s.exprRangeOrder {
+			es := list[i]
 			dir, base := splitFieldSelector(es)
 			targetTagExpr, err := t.checkout(dir)
 			if err != nil {
 				continue
 			}
-			err = fn(newExprHandler(t, targetTagExpr, base, es))
+			err = fn(newExprHandler(t, targetTagExpr, base, es, i))
 			if err != nil {
 				return err
 			}
@@ -930,6 +1058,7 @@ func (t *TagExpr) Range(fn func(*ExprHandler) error) error {
 				continue
 			}
 			omitNil := f.tagOp == tagOmitNil
+			owner := t.owner(f.fieldSelector)
 			mapKeyStructVM := f.mapKeyStructVM
 			mapOrSliceElemStructVM := f.mapOrSliceElemStructVM
 			valueIface := f.mapOrSliceIfaceKinds[0]
@@ -944,12 +1073,12 @@ func (t *TagExpr) Range(fn func(*ExprHandler) error) error {
 						if omitNil && p == nil {
 							continue
 						}
-						err = mapKeyStructVM.newTagExpr(p, keyPath).Range(fn)
+						err = owner.child(mapKeyStructVM.newTagExpr(p, keyPath)).Range(fn)
 						if err != nil {
 							return err
 						}
 					} else if keyIface {
-						err = t.subRange(omitNil, keyPath, key, fn)
+						err = owner.subRange(omitNil, keyPath, key, fn)
 						if err != nil {
 							return err
 						}
@@ -959,12 +1088,12 @@ func (t *TagExpr) Range(fn func(*ExprHandler) error) error {
 						if omitNil && p == nil {
 							continue
 						}
-						err = mapOrSliceElemStructVM.newTagExpr(p, f.fieldSelector+"{v for k="+key.String()+"}").Range(fn)
+						err = owner.child(mapOrSliceElemStructVM.newTagExpr(p, f.fieldSelector+"{v for k="+key.String()+"}")).Range(fn)
 						if err != nil {
 							return err
 						}
 					} else if valueIface {
-						err = t.subRange(omitNil, f.fieldSelector+"{v for k="+key.String()+"}", v.MapIndex(key), fn)
+						err = owner.subRange(omitNil, f.fieldSelector+"{v for k="+key.String()+"}", v.MapIndex(key), fn)
 						if err != nil {
 							return err
 						}
@@ -979,12 +1108,12 @@ func (t *TagExpr) Range(fn func(*ExprHandler) error) error {
 						if omitNil && p == nil {
 							continue
 						}
-						err = mapOrSliceElemStructVM.newTagExpr(p, f.fieldSelector+"["+strconv.Itoa(i)+"]").Range(fn)
+						err = owner.child(mapOrSliceElemStructVM.newTagExpr(p, f.fieldSelector+"["+strconv.Itoa(i)+"]")).Range(fn)
 						if err != nil {
 							return err
 						}
 					} else if valueIface {
-						err = t.subRange(omitNil, f.fieldSelector+"["+strconv.Itoa(i)+"]", v.Index(i), fn)
+						err = owner.subRange(omitNil, f.fieldSelector+"["+strconv.Itoa(i)+"]", v.Index(i), fn)
 						if err != nil {
 							return err
 						}
@@ -1000,7 +1129,7 @@ func (t *TagExpr) Range(fn func(*ExprHandler) error) error {
 				if err != nil {
 					return err
 				}
-				return te.Range(fn)
+				return t.owner(te.path).child(te).Range(fn)
 			})
 			if err != nil {
 				return err
@@ -1015,10 +1144,45 @@ func (t *TagExpr) subRange(omitNil bool, path string, value reflect.Value, fn fu
 		if err != nil {
 			return err
 		}
-		return te.Range(fn)
+		return t.child(te).Range(fn)
 	})
 }
 
+// child sets @te as the child of t, if it has no parent.
+func (t *TagExpr) child(te *TagExpr) *TagExpr {
+	if te.parent == nil && te != t {
+		te.parent = t
+	}
+	return te
+}
+
+// owner returns the TagExpr of the struct owning the field @fieldPath of t,
+// e.g. A for A.B, A.B[0] or A.B{k}.
+func (t *TagExpr) owner(fieldPath string) *TagExpr {
+	if i := strings.IndexAny(fieldPath, "[{"); i >= 0 {
+		fieldPath = fieldPath[:i]
+	}
+	dir, _ := splitFieldSelector(fieldPath)
+	if te, err := t.checkout(dir); err == nil {
+		return te
+	}
+	return t
+}
+
+// ancestor returns the root TagExpr if @root, otherwise the @up-th parent, nil if it does not exist.
+func (t *TagExpr) ancestor(up int, root bool) *TagExpr {
+	if root {
+		for t.parent != nil {
+			t = t.parent
+		}
+		return t
+	}
+	for ; up > 0 && t != nil; up-- {
+		t = t.parent
+	}
+	return t
+}
+
 var (
 	errFieldSelector = errors.New("field selector does not exist")
 	errOmitNil       = errors.New("omit nil")
@@ -1045,26 +1209,60 @@ func (t *TagExpr) checkout(fs string) (*TagExpr, error) {
 		return nil, errOmitNil
 	}
 	subTagExpr = f.origin.newTagExpr(ptr, t.path)
+	subTagExpr.parent = t.owner(fs)
 	t.sub[fs] = subTagExpr
 	return subTagExpr, nil
 }
 
 func (t *TagExpr) getValue(fieldSelector string, subFields []interface{}) (v interface{}) {
-	f := t.s.fields[fieldSelector]
-	if f == nil {
-		return nil
+	var vv reflect.Value
+	switch {
+	case t.s == nil:
+		vv = getDataField(t.data, fieldSelector)
+		if !vv.IsValid() {
+			return nil
+		}
+	case fieldSelector == "":
+		// the struct itself, only selected by Program
+		if t.ptr == nil {
+			return nil
+		}
+		vv = reflect.NewAt(t.s.typ, t.ptr).Elem()
+	default:
+		return t.getFieldValue(t.s.fields[fieldSelector], subFields)
 	}
-	if f.valueGetter == nil {
+	return getSubValue(vv, subFields)
+}
+
+// getFieldValue returns the value of the field @f of the struct.
+func (t *TagExpr) getFieldValue(f *fieldVM, subFields []interface{}) interface{} {
+	if f == nil || f.valueGetter == nil {
 		return nil
 	}
-	v = f.valueGetter(t.ptr)
+	v := f.valueGetter(t.ptr)
 	if v == nil {
 		return nil
 	}
 	if len(subFields) == 0 {
 		return v
 	}
-	vv := reflect.ValueOf(v)
+	return getSubValue(reflect.ValueOf(v), subFields)
+}
+
+func getSubValue(vv reflect.Value, subFields []interface{}) interface{} {
+	v, _ := lookupSubValue(vv, subFields)
+	return v
+}
+
+// lookupSubValue returns the value selected by the sub-selectors @subFields of @vv,
+// and false if it is missing, e.g. the index is out of range or the map key does not exist.
+// NOTE:
+//
+//	The negative index counts from the end, e.g. $[-1] is the last element;
+//	The slice bounds are clamped to the length, e.g. $[1:10] of three elements is $[1:3];
+//	[*] selects the elements of array and slice, or the sorted keys of map,
+//	and applies the rest sub-selectors to each of them, skipping the missing results.
+func lookupSubValue(vv reflect.Value, subFields []interface{}) (interface{}, bool) {
 	var kind reflect.Kind
 	for i, k := range subFields {
 		kind = vv.Kind()
@@ -1072,49 +1270,185 @@ func (t *TagExpr) getValue(fieldSelector string, subFields []interface{}) (v int
 			vv = vv.Elem()
 			kind = vv.Kind()
 		}
+		switch sub := k.(type) {
+		case wildcardSub:
+			return projectSubValue(vv, subFields[i+1:])
+		case sliceSub:
+			vv = sliceValue(vv, sub)
+			if !vv.IsValid() {
+				return nil, false
+			}
+			continue
+		}
 		switch kind {
 		case reflect.Slice, reflect.Array, reflect.String:
-			if float, ok := k.(float64); ok {
-				idx := int(float)
-				if idx >= vv.Len() {
-					return nil
-				}
-				vv = vv.Index(idx)
-			} else {
-				return nil
+			idx, ok := toIndex(k)
+			if !ok {
+				return nil, false
+			}
+			if idx < 0 {
+				idx += vv.Len()
+			}
+			if idx < 0 || idx >= vv.Len() {
+				return nil, false
 			}
+			vv = vv.Index(idx)
 		case reflect.Map:
-			k := safeConvert(reflect.ValueOf(k), vv.Type().Key())
+			k := convertMapKey(k, vv.Type().Key())
 			if !k.IsValid() {
-				return nil
+				return nil, false
 			}
 			vv = vv.MapIndex(k)
 		case reflect.Struct:
-			if float, ok := k.(float64); ok {
-				idx := int(float)
+			if idx, ok := toIndex(k); ok {
 				if idx < 0 || idx >= vv.NumField() {
-					return nil
+					return nil, false
 				}
 				vv = vv.Field(idx)
 			} else if str, ok := k.(string); ok {
 				vv = vv.FieldByName(str)
 			} else {
-				return nil
+				return nil, false
 			}
 		default:
 			if i < len(subFields)-1 {
-				return nil
+				return nil, false
 			}
 		}
 		if !vv.IsValid() {
-			return nil
+			return nil, false
 		}
 	}
 	raw := vv
 	for vv.Kind() == reflect.Ptr || vv.Kind() == reflect.Interface {
 		vv = vv.Elem()
 	}
-	return anyValueGetter(raw, vv)
+	return anyValueGetter(raw, vv), true
+}
+
+// sliceValue returns the sub-slice of array, slice or string @vv,
+// or the invalid value if @vv can not be sliced or the bounds are not numbers.
+func sliceValue(vv reflect.Value, sub sliceSub) reflect.Value {
+	switch vv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.String:
+	default:
+		return reflect.Value{}
+	}
+	n := vv.Len()
+	lo, ok0 := sliceBound(sub.lo, 0, n)
+	hi, ok1 := sliceBound(sub.hi, n, n)
+	if !ok0 || !ok1 {
+		return reflect.Value{}
+	}
+	if lo > hi {
+		lo = hi
+	}
+	if vv.Kind() == reflect.Array && !vv.CanAddr() {
+		a := reflect.New(vv.Type()).Elem()
+		a.Set(vv)
+		vv = a
+	}
+	return vv.Slice(lo, hi)
+}
+
+// sliceBound returns the slice bound @b clamped to [0, @n], and @def if it is omitted.
+func sliceBound(b interface{}, def, n int) (int, bool) {
+	if b == nil {
+		return def, true
+	}
+	i, ok := toIndex(b)
+	if !ok {
+		return 0, false
+	}
+	if i < 0 {
+		i += n
+	}
+	if i < 0 {
+		i = 0
+	} else if i > n {
+		i = n
+	}
+	return i, true
+}
+
+// projectSubValue returns the list of the sub-selectors @subFields applied to
+// each element of array and slice, or each sorted key of map @vv.
+func projectSubValue(vv reflect.Value, subFields []interface{}) (interface{}, bool) {
+	var elems []reflect.Value
+	switch vv.Kind() {
+	case reflect.Slice, reflect.Array:
+		elems = make([]reflect.Value, vv.Len())
+		for i := range elems {
+			elems[i] = vv.Index(i)
+		}
+	case reflect.Map:
+		elems = sortedMapKeys(vv)
+	default:
+		return nil, false
+	}
+	r := make([]interface{}, 0, len(elems))
+	for _, elem := range elems {
+		if v, ok := lookupSubValue(elem, subFields); ok {
+			r = append(r, v)
+		}
+	}
+	return r, true
+}
+
+// getDataField returns the value of map keys or struct fields
+// in the data by the field selector.
+func getDataField(data reflect.Value, fieldSelector string) reflect.Value {
+	if fieldSelector == "" {
+		return data
+	}
+	vv := data
+	for _, name := range strings.Split(fieldSelector, FieldSeparator) {
+		for vv.Kind() == reflect.Ptr || vv.Kind() == reflect.Interface {
+			vv = vv.Elem()
+		}
+		switch vv.Kind() {
+		case reflect.Map:
+			k := safeConvert(reflect.ValueOf(name), vv.Type().Key())
+			if !k.IsValid() {
+				return reflect.Value{}
+			}
+			vv = vv.MapIndex(k)
+		case reflect.Struct:
+			vv = vv.FieldByName(name)
+		default:
+			return reflect.Value{}
+		}
+		if !vv.IsValid() {
+			return vv
+		}
+	}
+	return vv
+}
+
+// toIndex converts the number to index, and returns false if @k is not a number.
+func toIndex(k interface{}) (int, bool) {
+	switch t := k.(type) {
+	case int64:
+		return int(t), int64(int(t)) == t
+	case uint64:
+		// the max int, out of range
+		return int(^uint(0) >> 1), true
+	case float64:
+		return int(t), true
+	}
+	return 0, false
+}
+
+// convertMapKey converts @k to the map key type @t.
+// NOTE:
+//
+//	The number is not converted to string as rune.
+func convertMapKey(k interface{}, t reflect.Type) reflect.Value {
+	v := reflect.ValueOf(k)
+	if t.Kind() == reflect.String && v.Kind() != reflect.String {
+		return reflect.Value{}
+	}
+	return safeConvert(v, t)
 }
 
 func safeConvert(v reflect.Value, t reflect.Type) reflect.Value {
@@ -1122,8 +1456,6 @@ func safeConvert(v reflect.Value, t reflect.Type) reflect.Value {
 	return v.Convert(t)
 }
 
-var float64Type = reflect.TypeOf(float64(0))
-
 func splitFieldSelector(selector string) (dir, base string) {
 	idx := strings.LastIndex(selector, ExprNameSeparator)
 	if idx != -1 {
@@ -1136,34 +1468,35 @@ func splitFieldSelector(selector string) (dir, base string) {
 	return "", selector
 }
 
-func getFloat64(kind reflect.Kind, p unsafe.Pointer) interface{} {
+// getNumber returns the number as int64, uint64 or float64.
+func getNumber(kind reflect.Kind, p unsafe.Pointer) interface{} {
 	switch kind {
 	case reflect.Float32:
 		return float64(*(*float32)(p))
 	case reflect.Float64:
 		return *(*float64)(p)
 	case reflect.Int:
-		return float64(*(*int)(p))
+		return int64(*(*int)(p))
 	case reflect.Int8:
-		return float64(*(*int8)(p))
+		return int64(*(*int8)(p))
 	case reflect.Int16:
-		return float64(*(*int16)(p))
+		return int64(*(*int16)(p))
 	case reflect.Int32:
-		return float64(*(*int32)(p))
+		return int64(*(*int32)(p))
 	case reflect.Int64:
-		return float64(*(*int64)(p))
+		return *(*int64)(p)
 	case reflect.Uint:
-		return float64(*(*uint)(p))
+		return uintToNumber(uint64(*(*uint)(p)))
 	case reflect.Uint8:
-		return float64(*(*uint8)(p))
+		return int64(*(*uint8)(p))
 	case reflect.Uint16:
-		return float64(*(*uint16)(p))
+		return int64(*(*uint16)(p))
 	case reflect.Uint32:
-		return float64(*(*uint32)(p))
+		return int64(*(*uint32)(p))
 	case reflect.Uint64:
-		return float64(*(*uint64)(p))
+		return uintToNumber(*(*uint64)(p))
 	case reflect.Uintptr:
-		return float64(*(*uintptr)(p))
+		return uintToNumber(uint64(*(*uintptr)(p)))
 	}
 	return nil
 }
@@ -1172,21 +1505,24 @@ func anyValueGetter(raw, elem reflect.Value) interface{} {
 	if !elem.IsValid() || !raw.IsValid() {
 		return nil
 	}
+	if t := elem.Type(); (t == timeType || t == durationType) && elem.CanInterface() {
+		return elem.Interface()
+	}
 	kind := elem.Kind()
 	switch kind {
 	case reflect.Float32, reflect.Float64,
 		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		if elem.CanAddr() {
-			return getFloat64(kind, unsafe.Pointer(elem.UnsafeAddr()))
+			return getNumber(kind, unsafe.Pointer(elem.UnsafeAddr()))
 		}
 		switch kind {
 		case reflect.Float32, reflect.Float64:
 			return elem.Float()
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			return float64(elem.Int())
+			return elem.Int()
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-			return float64(elem.Uint())
+			return uintToNumber(elem.Uint())
 		}
 	case reflect.String:
 		return elem.String()
@@ -15,6 +15,7 @@
 package tagexpr
 
 import (
+	"math"
 	"reflect"
 	"strconv"
 	"testing"
@@ -869,3 +870,412 @@ func TestIssue5(t *testing.T) {
 	})
 	assert.NoError(t, err)
 }
+
+func TestSyntaxErrorLocation(t *testing.T) {
+	type T struct {
+		A int `te:"ok:$>0; bad:$ > 0 &&"`
+	}
+	_, err := New("te").Run(new(T))
+	e, ok := err.(*SyntaxError)
+	if assert.True(t, ok, err) {
+		assert.Equal(t, "tagexpr.T", e.Struct)
+		assert.Equal(t, "A", e.Field)
+		assert.Equal(t, "te", e.Tag)
+		assert.Equal(t, "bad", e.ExprName)
+		assert.Equal(t, "$ > 0 &&", e.Expr)
+		assert.Equal(t, 8, e.Offset)
+		assert.Equal(t, "operand", e.Expected)
+		assert.Equal(t, "$ > 0 &&\n        ^", e.Excerpt())
+	}
+
+	type T2 struct {
+		A int `te:"a:$>0; a:$<9"`
+	}
+	_, err = New("te").Run(new(T2))
+	e, ok = err.(*SyntaxError)
+	if assert.True(t, ok, err) {
+		assert.Equal(t, "A", e.Field)
+		assert.Equal(t, "", e.ExprName)
+		assert.Equal(t, "a:$>0; a:$<9", e.Expr)
+		assert.Equal(t, 7, e.Offset)
+		assert.Equal(t, `duplicate expression name "a"`, e.Msg)
+	}
+}
+
+func TestShortCircuitGuard(t *testing.T) {
+	type T struct {
+		A []string `te:"$!=nil && len($[0])>1"`
+		B *[]int   `te:"$==nil || range($, #v>0)"`
+	}
+	vm := New("te")
+	assert.Equal(t, false, vm.MustRun(new(T)).Eval("A"))
+	assert.Equal(t, true, vm.MustRun(new(T)).Eval("B"))
+	assert.Equal(t, true, vm.MustRun(&T{A: []string{"ab"}}).Eval("A"))
+	assert.Equal(t, false, vm.MustRun(&T{B: &[]int{0}}).EvalBool("B"))
+}
+
+func TestIntegerPrecision(t *testing.T) {
+	type T struct {
+		A int64   `te:"$==9007199254740993"`
+		B uint64  `te:"$>9223372036854775807 && $-1==18446744073709551614"`
+		C []int64 `te:"$[0]!=$[1] && in($[0], 9007199254740993, 1)"`
+		D int64   `te:"$+1"`
+		E uint64  `te:"$+1"`
+	}
+	vm := New("te")
+	te := vm.MustRun(&T{
+		A: 9007199254740993,
+		B: math.MaxUint64,
+		C: []int64{9007199254740993, 9007199254740992},
+		D: math.MaxInt64,
+		E: math.MaxUint64,
+	})
+	assert.Equal(t, true, te.Eval("A"))
+	assert.Equal(t, true, te.Eval("B"))
+	assert.Equal(t, true, te.Eval("C"))
+	assert.EqualError(t, te.Eval("D").(error), "integer overflow: 9223372036854775807 + 1")
+	assert.EqualError(t, te.Eval("E").(error), "integer overflow: 18446744073709551615 + 1")
+	assert.Equal(t, false, vm.MustRun(&T{A: 9007199254740992}).Eval("A"))
+}
+
+func TestRegFuncShadowBuiltin(t *testing.T) {
+	defer func() {
+		for _, name := range []string{"max", "join", "count", "add"} {
+			delete(funcList, name)
+		}
+	}()
+	// the registrations made before the builtins were added
+	assert.NotPanics(t, func() {
+		MustRegFunc("max", func(args ...interface{}) interface{} {
+			return "user max"
+		})
+	})
+	for _, name := range []string{"join", "count", "add"} {
+		name := name
+		assert.NoError(t, RegFunc(name, func(args ...interface{}) interface{} {
+			return "user " + name
+		}), name)
+	}
+	assert.EqualError(t, RegFunc("max", func(args ...interface{}) interface{} { return nil }), "duplicate registration expression function: max")
+	assert.EqualError(t, RegFunc("len", func(args ...interface{}) interface{} { return nil }), "duplicate registration expression function: len")
+	type T struct {
+		A int `te:"max($, 1)"`
+		B int `te:"join($, ',')"`
+		C int `te:"count($, #v > 0)"`
+		D int `te:"add($, 1)"`
+		E int `te:"min($, 1)"`
+	}
+	te := New("te").MustRun(&T{A: 2})
+	assert.Equal(t, "user max", te.Eval("A"))
+	assert.Equal(t, "user join", te.Eval("B"))
+	assert.Equal(t, "user count", te.Eval("C"))
+	assert.Equal(t, "user add", te.Eval("D"))
+	assert.Equal(t, 0.0, te.Eval("E"))
+}
+
+func TestSprintfNumber(t *testing.T) {
+	type T struct {
+		A int    `te:"sprintf('%.2f', (A)$)"`
+		B uint64 `te:"sprintf('%.1f|%v', $, $)"`
+	}
+	vm := New("te")
+	te := vm.MustRun(&T{A: 5, B: 3})
+	assert.Equal(t, "5.00", te.Eval("A"))
+	assert.Equal(t, "3.0|3", te.Eval("B"))
+	assert.Equal(t, "5.00", te.Explain("A").Value)
+}
+
+func TestBitmask(t *testing.T) {
+	type T struct {
+		Perm  uint8  `te:"($ & 0x0F) != 0 && $ &^ 0b0011 == 0x0C"`
+		Flags uint64 `te:"$ & (1 << 63) != 0 && $ >> 60 == 0xF"`
+	}
+	vm := New("te")
+	te := vm.MustRun(&T{Perm: 0x0F, Flags: 0xF << 60})
+	assert.Equal(t, true, te.Eval("Perm"))
+	assert.Equal(t, true, te.Eval("Flags"))
+	te = vm.MustRun(&T{Perm: 0xF0, Flags: 1})
+	assert.Equal(t, false, te.Eval("Perm"))
+	assert.Equal(t, false, te.Eval("Flags"))
+}
+
+func TestScopedSelector(t *testing.T) {
+	type Tag struct {
+		Name string `te:"len($)>0 && (Currency)$parent==(Currency)$root"`
+	}
+	type Item struct {
+		Currency string `te:"$==(Currency)$root"`
+		Price    int    `te:"$<=(../Limits)$[(Currency)$]"`
+		Tags     []Tag
+	}
+	type Sub struct {
+		Code string `te:"$==(../../Currency)$ && (../Region)$!=''"`
+	}
+	type Meta struct {
+		Region string
+		Sub    Sub
+	}
+	type Order struct {
+		Currency string
+		Limits   map[string]int
+		Items    []*Item
+		Meta     Meta
+		Extra    interface{}
+		Parent   int `te:"$parent==nil && $root!=nil"`
+	}
+	vm := New("te")
+	order := &Order{
+		Currency: "USD",
+		Limits:   map[string]int{"USD": 100},
+		Items: []*Item{
+			{Currency: "USD", Price: 100, Tags: []Tag{{Name: "a"}}},
+			{Currency: "EUR", Price: 1, Tags: []Tag{{Name: "b"}}},
+		},
+		Meta:  Meta{Region: "US", Sub: Sub{Code: "USD"}},
+		Extra: &Item{Currency: "USD", Price: 101},
+	}
+	te := vm.MustRun(order)
+	results := make(map[string][]interface{})
+	err := te.Range(func(eh *ExprHandler) error {
+		results[eh.Path()] = append(results[eh.Path()], eh.Eval())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]interface{}{
+		"Parent":            {true},
+		"Items[0].Currency": {true},
+		"Items[0].Price":    {true},
+		"Items[1].Currency": {false},
+		"Items[1].Price":    {false},
+		// the elements of Items[1] and Items[0], in turn
+		"Tags[0].Name":   {false, true},
+		"Meta.Sub.Code":  {true},
+		"Extra.Currency": {true},
+		"Extra.Price":    {false},
+	}, results)
+	assert.Equal(t, true, te.Eval("Meta.Sub.Code"))
+
+	// the root struct has no parent
+	type Root struct {
+		A int `te:"(A)$parent==nil && (../A)$==nil && (A)$root==$"`
+	}
+	assert.Equal(t, true, vm.MustRun(&Root{A: 1}).Eval("A"))
+
+	_, err = vm.Run(&struct {
+		A int `te:"(../A)$root"`
+	}{})
+	assert.Error(t, err)
+
+	// the uncomparable structs are not equal
+	type Leaf struct {
+		A int `te:"$root==$parent"`
+		B int `te:"$root!=$parent && !in($root, $parent)"`
+	}
+	type Top struct {
+		Tags  []string
+		Leaf  Leaf
+		Items []interface{}
+	}
+	te = vm.MustRun(&Top{Tags: []string{"a"}})
+	assert.Equal(t, false, te.Eval("Leaf.A"))
+	assert.Equal(t, true, te.Eval("Leaf.B"))
+	// comparable type holding the uncomparable values
+	type Pair struct {
+		A, B [1]interface{}
+	}
+	v, err := MustCompile("(A)$==(B)$").Eval(&Pair{A: [1]interface{}{[]int{1}}, B: [1]interface{}{[]int{1}}})
+	assert.NoError(t, err)
+	assert.Equal(t, false, v)
+}
+
+func TestSubSelector(t *testing.T) {
+	type Item struct {
+		Name  string
+		Price int
+		Tags  []string
+	}
+	type T struct {
+		Nums  []int
+		Arr   [3]int
+		Str   string
+		Items []*Item
+		M     map[string]*Item
+		Nil   []int
+		Ptr   *Item
+
+		Last       interface{} `te:"$[-1]"`
+		OutOfRange interface{} `te:"(Nums)$[-4]"`
+		Sliced     interface{} `te:"(Nums)$[1:3]"`
+		Names      interface{} `te:"(Items)$[*].Name"`
+	}
+	vm := New("te")
+	obj := &T{
+		Nums: []int{1, 2, 3},
+		Arr:  [3]int{4, 5, 6},
+		Str:  "hello",
+		Items: []*Item{
+			{Name: "a", Price: 1, Tags: []string{"x"}},
+			nil,
+			{Name: "b", Price: 2},
+		},
+		M: map[string]*Item{"k2": {Name: "c"}, "k1": {Name: "d"}},
+	}
+	obj.Last = obj.Nums
+	te := vm.MustRun(obj)
+	assert.Equal(t, 3.0, te.Eval("Last"))
+	assert.Nil(t, te.Eval("OutOfRange"))
+	assert.Equal(t, []int{2, 3}, te.Eval("Sliced"))
+	// the nil element has no field, so it is skipped
+	assert.Equal(t, []interface{}{"a", "b"}, te.Eval("Names"))
+
+	cases := []struct {
+		expr string
+		val  interface{}
+	}{
+		{expr: "(Nums)$[-1]", val: int64(3)},
+		{expr: "(Nums)$[-3]", val: int64(1)},
+		{expr: "(Nums)$[3]", val: nil},
+		{expr: "(Nums)$[1:]", val: []int{2, 3}},
+		{expr: "(Nums)$[:-1]", val: []int{1, 2}},
+		{expr: "(Nums)$[-2:10]", val: []int{2, 3}},
+		{expr: "(Nums)$[2:1]", val: []int{}},
+		{expr: "(Nums)$[:][0]", val: int64(1)},
+		{expr: "(Nums)$[1:3][-1]", val: int64(3)},
+		{expr: "(Nums)$[true?1:2:3]", val: []int{2, 3}},
+		{expr: "(Nums)$['a':]", val: nil},
+		{expr: "(Arr)$[1:]", val: []int{5, 6}},
+		{expr: "(Str)$[1:3]", val: "el"},
+		{expr: "(Str)$[-5:(Nums)$[1]]", val: "he"},
+		{expr: "(Items)$[-1].Name", val: "b"},
+		{expr: "(Items)$[0].Tags[-1]", val: "x"},
+		{expr: "(Items)$[*].Price", val: []interface{}{int64(1), int64(2)}},
+		{expr: "(Items)$[*].Tags", val: []interface{}{[]string{"x"}, []string(nil)}},
+		{expr: "(Items)$[*].Tags[0]", val: []interface{}{"x"}},
+		{expr: "(Items)$[0:1][*]['Name']", val: []interface{}{"a"}},
+		{expr: "(M)$[*]", val: []interface{}{"k1", "k2"}},
+		{expr: "(M)$['k1'].Name", val: "d"},
+		{expr: "(M)$['k3'].Name", val: nil},
+		{expr: "(Nil)$[*]", val: []interface{}{}},
+		{expr: "(Ptr)$[*]", val: nil},
+		{expr: "(Str)$[*]", val: nil},
+		{expr: "len((Items)$[*].Name)", val: 2.0},
+		{expr: "len((M)$[*])", val: 2.0},
+		{expr: "in('b', (Items)$[*].Name)", val: true},
+		{expr: "in('c', (Items)$[*].Name)", val: false},
+		{expr: "in(2, (Nums)$[1:])", val: true},
+		{expr: "all((Items)$[*].Price, #v>0)", val: true},
+		{expr: "count((Nums)$[-2:], #v>2)", val: int64(1)},
+	}
+	for _, c := range cases {
+		p, err := Compile(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		v, err := p.Eval(obj)
+		assert.NoError(t, err, c.expr)
+		assert.Equal(t, c.val, v, c.expr)
+	}
+
+	for _, expr := range []string{"$[1:2:3]", "$[*]Name", "$[1:)]"} {
+		_, err := Compile(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestDynamicSubSelector(t *testing.T) {
+	type Line struct {
+		Currency string
+		Amount   int `te:"$<=(../Limits)$[(Currency)$]"`
+	}
+	type T struct {
+		Currency string
+		Limits   map[string]int
+		Amount   int      `te:"$<=(Limits)$[(Currency)$]"`
+		Rates    []int    `te:"$[len($)-1]>(Rates)$[0]"`
+		Codes    []string `te:"(Limits)$[$[0]]==(Limits)$[(Codes)$[len($)-1]]"`
+		Names    map[string]string
+		Bracket  string `te:"(Names)$[']']==$ && (Names)$['[x]']=='y' && (Names)$[(Currency)$=='USD'?']':'x']==$"`
+		Lines    []Line
+	}
+	vm := New("te")
+	obj := &T{
+		Currency: "USD",
+		Limits:   map[string]int{"USD": 100, "EUR": 80},
+		Amount:   100,
+		Rates:    []int{1, 2, 3},
+		Codes:    []string{"USD", "EUR"},
+		Names:    map[string]string{"]": "z", "[x]": "y"},
+		Bracket:  "z",
+		Lines:    []Line{{Currency: "EUR", Amount: 80}, {Currency: "USD", Amount: 101}},
+	}
+	te := vm.MustRun(obj)
+	assert.Equal(t, true, te.Eval("Amount"))
+	assert.Equal(t, true, te.Eval("Rates"))
+	assert.Equal(t, false, te.Eval("Codes"))
+	assert.Equal(t, true, te.Eval("Bracket"))
+	results := make(map[string]interface{})
+	err := te.Range(func(eh *ExprHandler) error {
+		results[eh.Path()] = eh.Eval()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, true, results["Lines[0].Amount"])
+	assert.Equal(t, false, results["Lines[1].Amount"])
+
+	obj.Currency = "JPY"
+	assert.Equal(t, false, te.Eval("Amount"))
+	obj.Limits["USD"] = 80
+	assert.Equal(t, true, te.Eval("Codes"))
+}
+
+func TestRangeOrder(t *testing.T) {
+	type Sub struct {
+		X int `te:"x2:2;x1:1"`
+		Y int `te:"#priority:2;y:1"`
+	}
+	type T struct {
+		A int `te:"c:1;a:1;b:1"`
+		B int `te:"$>0;#priority:1"`
+		S Sub
+		C int `te:"#priority:-1;z:1;@:1"`
+		D int `te:"#priority:1;d:1"`
+	}
+	vm := New("te")
+	te := vm.MustRun(&T{})
+	type item struct {
+		selector        string
+		index, priority int
+	}
+	var got []item
+	err := te.Range(func(eh *ExprHandler) error {
+		got = append(got, item{eh.StringSelector(), eh.Index(), eh.Priority()})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []item{
+		{"S.Y@y", 6, 2},
+		{"B", 3, 1},
+		{"D@d", 9, 1},
+		{"A@c", 0, 0},
+		{"A@a", 1, 0},
+		{"A@b", 2, 0},
+		{"S.X@x2", 4, 0},
+		{"S.X@x1", 5, 0},
+		{"C@z", 7, -1},
+		{"C", 8, -1},
+	}, got)
+
+	// the expression named priority is not the priority directive
+	type U struct {
+		A int `te:"priority:$>0"`
+	}
+	te = vm.MustRun(&U{A: 1})
+	assert.Equal(t, true, te.Eval("A@priority"))
+	got = got[:0]
+	err = te.Range(func(eh *ExprHandler) error {
+		got = append(got, item{eh.StringSelector(), eh.Index(), eh.Priority()})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []item{{"A@priority", 0, 0}}, got)
+}
@@ -2,6 +2,7 @@ package tagexpr
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -23,16 +24,21 @@ func (f *fieldVM) parseExprs(tag string) error {
 		return nil
 	}
 
-	kvs, err := parseTag(tag)
+	kvs, priority, err := parseTag(tag)
 	if err != nil {
-		return err
+		return f.wrapSyntaxError(err, "")
 	}
+	f.priority = priority
 	exprSelectorPrefix := f.structField.Name
 
-	for exprSelector, exprString := range kvs {
-		expr, err := parseExpr(exprString)
+	for _, kv := range kvs {
+		exprSelector := kv.key
+		expr, err := parseExprWithFuncs(kv.val, f.origin.vm.funcs)
+		if err == nil {
+			err = f.origin.vm.resolveEnv(expr)
+		}
 		if err != nil {
-			return err
+			return f.wrapSyntaxError(err, exprSelector)
 		}
 		if exprSelector == ExprNameSeparator {
 			exprSelector = exprSelectorPrefix
@@ -40,35 +46,129 @@ func (f *fieldVM) parseExprs(tag string) error {
 			exprSelector = exprSelectorPrefix + ExprNameSeparator + exprSelector
 		}
 		f.exprs[exprSelector] = expr
-		f.origin.exprs[exprSelector] = expr
-		f.origin.exprSelectorList = append(f.origin.exprSelectorList, exprSelector)
+		f.exprSelectorList = append(f.exprSelectorList, exprSelector)
+		f.origin.addExpr(exprSelector, expr, priority)
 	}
 	return nil
 }
 
-func parseTag(tag string) (map[string]string, error) {
+// CheckTag parses the struct tag value statically, and returns the first *SyntaxError,
+// such as the broken expression, the duplicate expression name or the unknown function.
+// NOTE:
+//
+//	The functions only registered by VM.RegFunc are unknown to it;
+//	The struct information of the *SyntaxError is empty.
+func CheckTag(tag string) error {
+	_, err := CompileTag(tag)
+	return err
+}
+
+// CompileTag parses the struct tag value into the programs by the expression names,
+// where the name of the unnamed expression is @.
+// NOTE:
+//
+//	If the tag is - or ?, return nil;
+//	The PriorityName directive is not an expression, so it is not returned;
+//	The error is the same as CheckTag.
+func CompileTag(tag string) (map[string]*Program, error) {
+	switch tag {
+	case tagOmit, tagOmitNil:
+		return nil, nil
+	}
+	kvs, _, err := parseTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	progs := make(map[string]*Program, len(kvs))
+	for _, kv := range kvs {
+		expr, err := parseExpr(kv.val)
+		if err != nil {
+			if e, ok := err.(*SyntaxError); ok {
+				e.ExprName = kv.key
+			}
+			return nil, err
+		}
+		expr.compile(nil, "")
+		progs[kv.key] = &Program{src: kv.val, expr: expr}
+	}
+	return progs, nil
+}
+
+// wrapSyntaxError adds the struct field information to the *SyntaxError.
+func (f *fieldVM) wrapSyntaxError(err error, exprName string) error {
+	if e, ok := err.(*SyntaxError); ok {
+		e.Struct = f.origin.name
+		e.Field = f.structField.Name
+		e.Tag = f.origin.vm.tagName
+		e.ExprName = exprName
+	}
+	return err
+}
+
+// tagKV the expression name and source in the struct tag.
+type tagKV struct {
+	key, val string
+}
+
+// parseTag returns the expressions of the struct tag in the declared order,
+// and the priority set by the PriorityName directive, which is 0 by default.
+func parseTag(tag string) (kvs []tagKV, priority int, err error) {
 	s := tag
 	ptr := &s
-	kvs := make(map[string]string)
+	var hasPriority bool
 	for {
 		one, err := readOneExpr(ptr)
 		if err != nil {
-			return nil, err
+			return nil, 0, &SyntaxError{Expr: tag, Offset: len(tag), Expected: `closing "'"`}
 		}
 		if one == "" {
-			return kvs, nil
+			return kvs, priority, nil
+		}
+		if val, ok := splitPriority(one); ok {
+			if hasPriority {
+				return nil, 0, &SyntaxError{Expr: tag, Offset: tagOffset(tag, one), Msg: "duplicate " + PriorityName}
+			}
+			priority, err = strconv.Atoi(strings.TrimSpace(val))
+			if err != nil {
+				return nil, 0, &SyntaxError{Expr: tag, Offset: tagOffset(tag, one) + strings.Index(strings.TrimSpace(one), ":") + 1, Expected: "integer priority"}
+			}
+			hasPriority = true
+			continue
 		}
 		key, val := splitExpr(one)
 		if val == "" {
-			return nil, fmt.Errorf("syntax error: %q expression string can not be empty", tag)
+			return nil, 0, &SyntaxError{Expr: tag, Offset: tagOffset(tag, one) + len(one), Expected: "expression"}
 		}
-		if _, ok := kvs[key]; ok {
-			return nil, fmt.Errorf("syntax error: %q duplicate expression name %q", tag, key)
+		for _, kv := range kvs {
+			if kv.key == key {
+				return nil, 0, &SyntaxError{Expr: tag, Offset: tagOffset(tag, one), Msg: fmt.Sprintf("duplicate expression name %q", key)}
+			}
 		}
-		kvs[key] = val
+		kvs = append(kvs, tagKV{key: key, val: val})
 	}
 }
 
+// tagOffset returns the byte offset of the last @one in the @tag.
+func tagOffset(tag, one string) int {
+	if i := strings.LastIndex(tag, strings.TrimSpace(one)); i >= 0 {
+		return i
+	}
+	return len(tag)
+}
+
+// splitPriority returns the value of the PriorityName directive, e.g. 1 of #priority:1.
+func splitPriority(one string) (val string, ok bool) {
+	s := strings.TrimSpace(one)
+	if !strings.HasPrefix(s, PriorityName) {
+		return "", false
+	}
+	s = strings.TrimSpace(s[len(PriorityName):])
+	if !strings.HasPrefix(s, ":") {
+		return "", false
+	}
+	return s[1:], true
+}
+
 func splitExpr(one string) (key, val string) {
 	one = strings.TrimSpace(one)
 	if one == "" {
@@ -107,13 +207,24 @@ func readOneExpr(tag *string) (string, error) {
 	if s[len(s)-1] != ';' {
 		s += ";"
 	}
-	a := strings.SplitAfter(strings.Replace(s, "\\'", "##", -1), ";")
+	a := strings.SplitAfter(quoteEscapeReplacer.Replace(s), ";")
 	var idx = -1
 	var patch int
+	var start int // the start of the current statement
 	for _, v := range a {
 		idx += len(v)
 		count := strings.Count(v, "'")
 		if (count+patch)%2 == 0 {
+			stmt := s[start:idx]
+			if start == 0 {
+				// without the expression name
+				_, stmt = splitExpr(stmt)
+			}
+			// the ';' after the let-binding is not the end of the expression
+			if name, _ := readLetHead(strings.TrimSpace(stmt)); name != "" && idx+1 < len(s) {
+				start, patch = idx+1, 0
+				continue
+			}
 			*tag = s[idx+1:]
 			return s[:idx], nil
 		}
@@ -134,6 +245,46 @@ func trimRightSpace(p *string) *string {
 	return p
 }
 
+// quoteEscapeReplacer replaces the escaped backslashes and quotes with the same length,
+// so that the quotes can be counted.
+var quoteEscapeReplacer = strings.NewReplacer(`\\`, "##", `\'`, "##")
+
+// readQuotedString reads the single-quoted string at the beginning of @p,
+// in which \' is the quote, \\ is the backslash, and the other backslashes are kept, e.g. '\d'.
+func readQuotedString(p *string) *string {
+	s := *p
+	if len(s) == 0 || s[0] != '\'' {
+		return nil
+	}
+	var b []byte // the unescaped string, nil if there is no escape
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '\\' || s[i+1] == '\'') {
+				if b == nil {
+					b = append(make([]byte, 0, len(s)), s[1:i]...)
+				}
+				i++
+				b = append(b, s[i])
+				continue
+			}
+		case '\'':
+			*p = s[i+1:]
+			if b == nil {
+				// keep sharing the source, so that the parsing position can be located
+				s = s[1:i]
+				return &s
+			}
+			s = string(b)
+			return &s
+		}
+		if b != nil {
+			b = append(b, s[i])
+		}
+	}
+	return nil
+}
+
 func readPairedSymbol(p *string, left, right rune) *string {
 	s := *p
 	if len(s) == 0 || rune(s[0]) != left {
@@ -149,6 +300,11 @@ func readPairedSymbol(p *string, left, right rune) *string {
 		if realEqual, escapeEqual = equalRune(right, r, last1, last2); realEqual {
 			if leftLevel == rightLevel {
 				*p = s[i+1:]
+				if len(escapeIndexes) == 0 {
+					// keep sharing the source, so that the parsing position can be located
+					s = s[:i]
+					return &s
+				}
 				var sub = make([]rune, 0, i)
 				for k, v := range s[:i] {
 					if !escapeIndexes[k] {
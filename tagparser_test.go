@@ -52,6 +52,12 @@ func TestTagparser(t *testing.T) {
 				"b": `'1\'23'`,
 				"c": `'1\'2\'3'`,
 			},
+		}, {
+			tag: `tagexpr:"a:'1;\\\\';b:'\\\\\\';'"`,
+			expect: map[string]string{
+				"a": `'1;\\'`,
+				"b": `'\\\';'`,
+			},
 		}, {
 			tag: `tagexpr:"email($)"`,
 			expect: map[string]string{
@@ -66,7 +72,14 @@ func TestTagparser(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		r, e := parseTag(c.tag.Get("tagexpr"))
+		kvs, _, e := parseTag(c.tag.Get("tagexpr"))
+		var r map[string]string
+		for _, kv := range kvs {
+			if r == nil {
+				r = make(map[string]string)
+			}
+			r[kv.key] = kv.val
+		}
 		if e != nil == c.fail {
 			assert.Equal(t, c.expect, r, c.tag)
 		} else {
@@ -77,3 +90,54 @@ func TestTagparser(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTagOrder(t *testing.T) {
+	kvs, priority, err := parseTag(`c:3;a:1; #priority: -2 ;@:0;b:2`)
+	assert.NoError(t, err)
+	assert.Equal(t, -2, priority)
+	assert.Equal(t, []tagKV{{"c", "3"}, {"a", "1"}, {"@", "0"}, {"b", "2"}}, kvs)
+
+	kvs, priority, err = parseTag(`$>0`)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, priority)
+	assert.Equal(t, []tagKV{{"@", "$>0"}}, kvs)
+
+	_, _, err = parseTag(`$>0;#priority:high`)
+	assert.EqualError(t, err, "syntax error: expected integer priority at offset 14\n\t$>0;#priority:high\n\t              ^")
+	_, _, err = parseTag(`#priority:1;#priority:2`)
+	assert.EqualError(t, err, "syntax error: duplicate #priority at offset 12\n\t#priority:1;#priority:2\n\t            ^")
+
+	// priority is an ordinary expression name
+	kvs, priority, err = parseTag(`priority:$>0;#priority:1`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, priority)
+	assert.Equal(t, []tagKV{{"priority", "$>0"}}, kvs)
+}
+
+func TestCheckTag(t *testing.T) {
+	assert.NoError(t, CheckTag(`$>0;msg:sprintf('%v', $)`))
+	assert.NoError(t, CheckTag(`-`))
+	assert.EqualError(t, CheckTag(`a:$>;b:1`), "syntax error: expr a: expected operand at offset 2\n\t$>\n\t  ^")
+	assert.EqualError(t, CheckTag(`a:1;a:2`), "syntax error: duplicate expression name \"a\" at offset 4\n\ta:1;a:2\n\t    ^")
+	assert.EqualError(t, CheckTag(`foo($)`), "syntax error: expr @: unknown function \"foo\" at offset 0\n\tfoo($)\n\t^")
+	assert.EqualError(t, CheckTag(`substr($)`), "syntax error: expr @: substr() expects 2 to 3 arguments, got 1 at offset 0\n\tsubstr($)\n\t^")
+}
+
+func TestCompileTag(t *testing.T) {
+	progs, err := CompileTag(`$>0;msg:sprintf('%v', $)`)
+	assert.NoError(t, err)
+	assert.Len(t, progs, 2)
+	assert.Equal(t, "$>0", progs["@"].String())
+	assert.Equal(t, "sprintf('%v', $)", Format(progs["msg"].Root()))
+	progs, err = CompileTag(`?`)
+	assert.NoError(t, err)
+	assert.Nil(t, progs)
+	progs, err = CompileTag(`#priority:1;$>0`)
+	assert.NoError(t, err)
+	assert.Len(t, progs, 1)
+	progs, err = CompileTag(`priority:$>0`)
+	assert.NoError(t, err)
+	assert.Equal(t, "$>0", progs["priority"].String())
+	_, err = CompileTag(`a:$>`)
+	assert.EqualError(t, err, "syntax error: expr a: expected operand at offset 2\n\t$>\n\t  ^")
+}
@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"context"
 	"errors"
 	"regexp"
 
@@ -35,20 +36,145 @@ func MustRegFunc(funcName string, fn func(args ...interface{}) error, force ...b
 //	The go number types always are float64;
 //	The go string types always are string.
 func RegFunc(funcName string, fn func(args ...interface{}) error, force ...bool) error {
-	return tagexpr.RegFunc(funcName, func(args ...interface{}) interface{} {
+	return tagexpr.RegFunc(funcName, wrapFunc(fn), force...)
+}
+
+// MustRegFunc registers validator function expression only for the Validator.
+// NOTE:
+//
+//	panic if exist error;
+//	The same as the global MustRegFunc, but the function shadows the global one with the same @funcName.
+func (v *Validator) MustRegFunc(funcName string, fn func(args ...interface{}) error, force ...bool) {
+	err := v.RegFunc(funcName, fn, force...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegFunc registers validator function expression only for the Validator.
+// NOTE:
+//
+//	The Validator inherits the global functions, and the function shadows the global one with the same @funcName;
+//	If @force=true, allow to cover the existed same @funcName registered by the Validator;
+//	It should be called before the struct is validated for the first time.
+func (v *Validator) RegFunc(funcName string, fn func(args ...interface{}) error, force ...bool) error {
+	return v.vm.RegFunc(funcName, wrapFunc(fn), force...)
+}
+
+// MustRegFuncSig registers validator function expression with the signature.
+// NOTE:
+//
+//	panic if exist error;
+//	The same as RegFuncSig.
+func MustRegFuncSig(funcName string, sig tagexpr.FuncSignature, fn func(args ...interface{}) error, force ...bool) {
+	err := RegFuncSig(funcName, sig, fn, force...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegFuncSig registers validator function expression with the signature.
+// NOTE:
+//
+//	example: RegFuncSig("phone", tagexpr.FuncSignature{In: []tagexpr.Kind{tagexpr.StringKind, tagexpr.StringKind}, Optional: 1}, fn);
+//	The mismatched number or kinds of arguments, e.g. phone($,'CN','x'),
+//	are rejected when the struct is validated for the first time;
+//	If @force=true, allow to cover the existed same @funcName.
+func RegFuncSig(funcName string, sig tagexpr.FuncSignature, fn func(args ...interface{}) error, force ...bool) error {
+	sig.Out = tagexpr.BoolKind
+	return tagexpr.RegFuncSig(funcName, sig, wrapFunc(fn), force...)
+}
+
+// MustRegFuncSig registers validator function expression with the signature only for the Validator.
+// NOTE:
+//
+//	panic if exist error;
+//	The same as Validator.RegFuncSig.
+func (v *Validator) MustRegFuncSig(funcName string, sig tagexpr.FuncSignature, fn func(args ...interface{}) error, force ...bool) {
+	err := v.RegFuncSig(funcName, sig, fn, force...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegFuncSig registers validator function expression with the signature only for the Validator.
+// NOTE:
+//
+//	The same as the global RegFuncSig, but the function shadows the global one with the same @funcName.
+func (v *Validator) RegFuncSig(funcName string, sig tagexpr.FuncSignature, fn func(args ...interface{}) error, force ...bool) error {
+	sig.Out = tagexpr.BoolKind
+	return v.vm.RegFuncSig(funcName, sig, wrapFunc(fn), force...)
+}
+
+// MustRegFuncCtx registers validator function expression with the context.
+// NOTE:
+//
+//	panic if exist error;
+//	The same as RegFuncCtx.
+func MustRegFuncCtx(funcName string, fn func(ctx context.Context, args ...interface{}) error, force ...bool) {
+	err := RegFuncCtx(funcName, fn, force...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegFuncCtx registers validator function expression with the context.
+// NOTE:
+//
+//	@ctx is the one passed to Validator.ValidateContext, or context.Background() for Validate;
+//	If @force=true, allow to cover the existed same @funcName;
+//	The go number types always are float64;
+//	The go string types always are string.
+func RegFuncCtx(funcName string, fn func(ctx context.Context, args ...interface{}) error, force ...bool) error {
+	return tagexpr.RegFuncCtx(funcName, wrapFuncCtx(fn), force...)
+}
+
+// MustRegFuncCtx registers validator function expression with the context only for the Validator.
+// NOTE:
+//
+//	panic if exist error;
+//	The same as Validator.RegFuncCtx.
+func (v *Validator) MustRegFuncCtx(funcName string, fn func(ctx context.Context, args ...interface{}) error, force ...bool) {
+	err := v.RegFuncCtx(funcName, fn, force...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegFuncCtx registers validator function expression with the context only for the Validator.
+// NOTE:
+//
+//	The same as the global RegFuncCtx, but the function shadows the global one with the same @funcName.
+func (v *Validator) RegFuncCtx(funcName string, fn func(ctx context.Context, args ...interface{}) error, force ...bool) error {
+	return v.vm.RegFuncCtx(funcName, wrapFuncCtx(fn), force...)
+}
+
+func wrapFuncCtx(fn func(ctx context.Context, args ...interface{}) error) func(ctx context.Context, args ...interface{}) (interface{}, error) {
+	return func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		err := fn(ctx, args...)
+		if err == nil {
+			// nil defaults to false, so returns true
+			return true, nil
+		}
+		return nil, err
+	}
+}
+
+func wrapFunc(fn func(args ...interface{}) error) func(args ...interface{}) interface{} {
+	return func(args ...interface{}) interface{} {
 		err := fn(args...)
 		if err == nil {
 			// nil defaults to false, so returns true
 			return true
 		}
 		return err
-	}, force...)
+	}
 }
 
 func init() {
 	var pattern = "^([A-Za-z0-9_\\-\\.\u4e00-\u9fa5])+\\@([A-Za-z0-9_\\-\\.])+\\.([A-Za-z]{2,8})$"
 	emailRegexp := regexp.MustCompile(pattern)
-	MustRegFunc("email", func(args ...interface{}) error {
+	MustRegFuncSig("email", tagexpr.FuncSignature{In: []tagexpr.Kind{tagexpr.StringKind}}, func(args ...interface{}) error {
 		if len(args) != 1 {
 			return errors.New("number of parameters of email function is not one")
 		}
@@ -67,7 +193,7 @@ func init() {
 
 func init() {
 	// phone: defaultRegion is 'CN'
-	MustRegFunc("phone", func(args ...interface{}) error {
+	MustRegFuncSig("phone", tagexpr.FuncSignature{In: []tagexpr.Kind{tagexpr.StringKind, tagexpr.StringKind}, Optional: 1}, func(args ...interface{}) error {
 		var numberToParse, defaultRegion string
 		var ok bool
 		switch len(args) {
@@ -16,6 +16,7 @@
 package validator
 
 import (
+	"context"
 	"errors"
 	"io"
 	"reflect"
@@ -57,11 +58,34 @@ func (v *Validator) VM() *tagexpr.VM {
 // NOTE:
 //  If checkAll=true, validate all the error.
 func (v *Validator) Validate(value interface{}, checkAll ...bool) error {
+	return v.ValidateContext(context.Background(), value, checkAll...)
+}
+
+// ValidateWithEnv validates whether the fields of value is valid with the env variables,
+// e.g. the threshold minVal of `vd:"$>=minVal"` from the config.
+// NOTE:
+//  If checkAll=true, validate all the error;
+//  The variables declared by VM().DeclareEnv are checked and converted first.
+func (v *Validator) ValidateWithEnv(value interface{}, env map[string]interface{}, checkAll ...bool) error {
+	ctx, err := v.vm.WithEnv(context.Background(), env)
+	if err != nil {
+		return err
+	}
+	return v.ValidateContext(ctx, value, checkAll...)
+}
+
+// ValidateContext validates whether the fields of value is valid with the context,
+// which is passed to the functions registered by RegFuncCtx.
+// NOTE:
+//  If checkAll=true, validate all the error;
+//  If the context is done, stop validating and return the context error.
+func (v *Validator) ValidateContext(ctx context.Context, value interface{}, checkAll ...bool) error {
 	var all bool
 	if len(checkAll) > 0 {
 		all = checkAll[0]
 	}
 	var errs = make([]error, 0, 8)
+	var ctxErr error
 	err := v.vm.RunAny(value, func(te *tagexpr.TagExpr, err error) error {
 		if err != nil {
 			errs = append(errs, err)
@@ -75,7 +99,10 @@ func (v *Validator) Validate(value interface{}, checkAll ...bool) error {
 			if strings.Contains(eh.StringSelector(), tagexpr.ExprNameSeparator) {
 				return nil
 			}
-			r := eh.Eval()
+			if ctxErr = ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			r := eh.EvalContext(ctx)
 			if r == nil {
 				return nil
 			}
@@ -96,7 +123,7 @@ func (v *Validator) Validate(value interface{}, checkAll ...bool) error {
 					}
 				}
 			}
-			msg := eh.TagExpr().EvalString(eh.StringSelector() + tagexpr.ExprNameSeparator + ErrMsgExprName)
+			msg, _ := eh.TagExpr().EvalContext(ctx, eh.StringSelector()+tagexpr.ExprNameSeparator+ErrMsgExprName).(string)
 			if msg == "" && rerr != nil {
 				msg = rerr.Error()
 			}
@@ -106,7 +133,8 @@ func (v *Validator) Validate(value interface{}, checkAll ...bool) error {
 			}
 			return io.EOF
 		})
-		if err != nil && !all {
+		// A canceled context stops the validation even if all is set.
+		if err != nil && (!all || err == ctxErr) {
 			return err
 		}
 		return nil
@@ -128,6 +156,17 @@ func (v *Validator) Validate(value interface{}, checkAll ...bool) error {
 	}
 }
 
+// Check checks the struct tag expressions of the struct type statically, and returns the problems found.
+// NOTE:
+//  The same as tagexpr.VM.Check, and additionally reports the non-boolean validation expressions
+//  and the msg expressions that are not strings.
+func (v *Validator) Check(structOrType interface{}) ([]tagexpr.Diagnostic, error) {
+	return v.vm.Check(structOrType, map[string]tagexpr.Kind{
+		MatchExprName:  tagexpr.BoolKind,
+		ErrMsgExprName: tagexpr.StringKind,
+	})
+}
+
 // SetErrorFactory customizes the factory of validation error.
 // NOTE:
 //  If errFactory==nil, the default is used
@@ -1,12 +1,15 @@
 package validator_test
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/bytedance/go-tagexpr/v2"
 	vd "github.com/bytedance/go-tagexpr/v2/validator"
 )
 
@@ -295,9 +298,12 @@ func TestIssue31(t *testing.T) {
 	type TStruct struct {
 		A []int32 `vd:"$ == nil || ($ != nil && range($, in(#v, 1, 2, 3))"`
 	}
-	assert.EqualError(t, vd.Validate(&TStruct{A: []int32{1}}), "syntax error: \"($ != nil && range($, in(#v, 1, 2, 3))\"")
-	assert.EqualError(t, vd.Validate(&TStruct{A: []int32{1}}), "syntax error: \"($ != nil && range($, in(#v, 1, 2, 3))\"")
-	assert.EqualError(t, vd.Validate(&TStruct{A: []int32{1}}), "syntax error: \"($ != nil && range($, in(#v, 1, 2, 3))\"")
+	errMsg := "syntax error: struct validator_test.TStruct, field A, tag vd, expr @: expected ')' at offset 50\n" +
+		"\t$ == nil || ($ != nil && range($, in(#v, 1, 2, 3))\n" +
+		"\t                                                  ^"
+	assert.EqualError(t, vd.Validate(&TStruct{A: []int32{1}}), errMsg)
+	assert.EqualError(t, vd.Validate(&TStruct{A: []int32{1}}), errMsg)
+	assert.EqualError(t, vd.Validate(&TStruct{A: []int32{1}}), errMsg)
 }
 
 func TestRegexp(t *testing.T) {
@@ -323,3 +329,195 @@ func TestRangeIn(t *testing.T) {
 	})
 	assert.EqualError(t, err, "invalid parameter: F")
 }
+
+func TestTernaryMsg(t *testing.T) {
+	type T struct {
+		A int `vd:"$>0 && $<100; msg:$<=0 ? 'must be positive' : 'too large'"`
+	}
+	assert.NoError(t, vd.Validate(&T{A: 1}))
+	assert.EqualError(t, vd.Validate(&T{A: -1}), "must be positive")
+	assert.EqualError(t, vd.Validate(&T{A: 100}), "too large")
+}
+
+func TestValidatorRegFunc(t *testing.T) {
+	type T struct {
+		A string `vd:"phone($)"`
+		B string `vd:"tenantCode($)"`
+	}
+	v1 := vd.New("vd")
+	v1.MustRegFunc("phone", func(args ...interface{}) error {
+		if s, _ := args[0].(string); len(s) == 4 {
+			return nil
+		}
+		return errors.New("not a 4-digit extension")
+	})
+	v1.MustRegFunc("tenantCode", func(args ...interface{}) error {
+		return nil
+	})
+	assert.EqualError(t, v1.RegFunc("tenantCode", func(args ...interface{}) error { return nil }),
+		"duplicate registration expression function: tenantCode")
+	assert.NoError(t, v1.Validate(&T{A: "1234", B: "x"}))
+	assert.EqualError(t, v1.Validate(&T{A: "12345", B: "x"}), "not a 4-digit extension")
+
+	// the other validator still uses the global phone, and has no tenantCode
+	v2 := vd.New("vd")
+	err := v2.Validate(&T{A: "1234", B: "x"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown function "tenantCode"`)
+	type P struct {
+		A string `vd:"phone($)"`
+	}
+	assert.NoError(t, v2.Validate(&P{A: "+8618812345678"}))
+	assert.Error(t, v2.Validate(&P{A: "1234"}))
+}
+
+func TestValidatorRegFuncSig(t *testing.T) {
+	v := vd.New("vd")
+	v.MustRegFuncSig("minAge", tagexpr.FuncSignature{
+		In: []tagexpr.Kind{tagexpr.NumberKind, tagexpr.NumberKind},
+	}, func(args ...interface{}) error {
+		if args[0].(float64) < args[1].(float64) {
+			return errors.New("too young")
+		}
+		return nil
+	})
+	type T struct {
+		Age int `vd:"minAge($, 18)"`
+	}
+	assert.NoError(t, v.Validate(&T{Age: 18}))
+	assert.EqualError(t, v.Validate(&T{Age: 17}), "too young")
+
+	type T2 struct {
+		Name string `vd:"minAge($, 18)"`
+	}
+	err := v.Validate(&T2{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "minAge() argument 1 expects number, got string")
+
+	type T3 struct {
+		Phone string `vd:"phone($,'CN','x')"`
+	}
+	err = v.Validate(&T3{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "phone() expects 1 to 2 arguments, got 3")
+}
+
+func TestValidatorCheck(t *testing.T) {
+	type T struct {
+		A string `vd:"email($)"`
+		B string `vd:"$"`
+		C int    `vd:"@:$>0; msg:$"`
+		D int    `vd:"@:(X)$>0; msg:sprintf('bad %v', $)"`
+	}
+	diags, err := vd.New("vd").Check(&T{})
+	assert.NoError(t, err)
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		"struct validator_test.T, field B, tag vd, expr @: expression expects bool result, got string at offset 0",
+		"struct validator_test.T, field C, tag vd, expr msg: expression expects string result, got number at offset 0",
+		`struct validator_test.T, field D, tag vd, expr @: unknown field "X" at offset 0`,
+	}, got)
+}
+
+func TestValidateContext(t *testing.T) {
+	type tenantKey struct{}
+	v := vd.New("vd")
+	v.MustRegFuncCtx("ownedByTenant", func(ctx context.Context, args ...interface{}) error {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		if s, _ := args[0].(string); tenant != "" && strings.HasPrefix(s, tenant+"-") {
+			return nil
+		}
+		return errors.New("resource not owned by tenant")
+	})
+	type T struct {
+		ID string `vd:"ownedByTenant($)"`
+	}
+	ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+	assert.NoError(t, v.ValidateContext(ctx, &T{ID: "acme-1"}))
+	assert.EqualError(t, v.ValidateContext(ctx, &T{ID: "other-1"}), "resource not owned by tenant")
+	assert.EqualError(t, v.Validate(&T{ID: "acme-1"}), "resource not owned by tenant")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, v.ValidateContext(canceled, &T{ID: "acme-1"}))
+	assert.Equal(t, context.Canceled, v.ValidateContext(canceled, &T{ID: "acme-1"}, true))
+
+	// A context canceled after the last field was validated does not fail the struct.
+	var cancelLate context.CancelFunc
+	v.MustRegFuncCtx("cancelLate", func(ctx context.Context, args ...interface{}) error {
+		cancelLate()
+		return nil
+	})
+	type U struct {
+		ID string `vd:"ownedByTenant($) && cancelLate()"`
+	}
+	for _, all := range []bool{false, true} {
+		late, cancel := context.WithCancel(ctx)
+		cancelLate = cancel
+		assert.NoError(t, v.ValidateContext(late, &U{ID: "acme-1"}, all))
+	}
+}
+
+func TestValidateWithEnv(t *testing.T) {
+	v := vd.New("vd")
+	v.VM().MustDeclareEnv("minVal", tagexpr.EnvVar{Kind: tagexpr.NumberKind, Required: true})
+	v.VM().MustDeclareEnv("maxLen", tagexpr.EnvVar{Kind: tagexpr.NumberKind, Default: 3})
+	type T struct {
+		A int    `vd:"@:$>=minVal; msg:sprintf('A must be at least %v', minVal)"`
+		B string `vd:"len($)<=maxLen"`
+	}
+	assert.NoError(t, v.ValidateWithEnv(&T{A: 10, B: "abc"}, map[string]interface{}{"minVal": 10}))
+	assert.EqualError(t, v.ValidateWithEnv(&T{A: 10}, map[string]interface{}{"minVal": "11"}), "A must be at least 11")
+	assert.EqualError(t, v.ValidateWithEnv(&T{A: 10, B: "abcd"}, map[string]interface{}{"minVal": 1}), "invalid parameter: B")
+	assert.NoError(t, v.ValidateWithEnv(&T{A: 10, B: "abcd"}, map[string]interface{}{"minVal": 1, "maxLen": 4}))
+	assert.EqualError(t, v.ValidateWithEnv(&T{}, nil), `missing env variable: "minVal"`)
+
+	// the env without declarations
+	type U struct {
+		A int `vd:"$>=minVal"`
+	}
+	assert.NoError(t, vd.ValidateWithEnv(&U{A: 1}, map[string]interface{}{"minVal": 1}))
+	assert.EqualError(t, vd.ValidateWithEnv(&U{A: 1}, map[string]interface{}{"minVal": 2}), "invalid parameter: A")
+}
+
+func TestValidateScopedSelector(t *testing.T) {
+	type Item struct {
+		Currency string `vd:"@:$==(Currency)$root; msg:sprintf('currency %s does not match the order', $)"`
+		Price    int    `vd:"$<=(../MaxPrice)$"`
+	}
+	type Order struct {
+		Currency string
+		MaxPrice int
+		Items    []Item
+	}
+	v := vd.New("vd")
+	assert.NoError(t, v.Validate(&Order{Currency: "USD", MaxPrice: 10, Items: []Item{{Currency: "USD", Price: 10}}}, true))
+	assert.EqualError(t, v.Validate(&Order{Currency: "USD", MaxPrice: 10, Items: []Item{{Currency: "EUR", Price: 1}}}, true), "currency EUR does not match the order")
+	assert.EqualError(t, v.Validate(&Order{Currency: "USD", MaxPrice: 10, Items: []Item{{Currency: "USD", Price: 11}}}, true), "invalid parameter: Items[0].Price")
+}
+
+func TestValidatePriority(t *testing.T) {
+	type T struct {
+		A int    `vd:"$>0"`
+		B string `vd:"#priority:1; @:len($)>0; msg:'B is required'"`
+		C int    `vd:"$>0; #priority:-1"`
+	}
+	v := vd.New("vd")
+	assert.EqualError(t, v.Validate(&T{}), "B is required")
+	assert.EqualError(t, v.Validate(&T{B: "b"}), "invalid parameter: A")
+	assert.EqualError(t, v.Validate(&T{A: 1, B: "b"}), "invalid parameter: C")
+	assert.EqualError(t, v.Validate(&T{}, true), "B is required\tinvalid parameter: A\tinvalid parameter: C")}
+
+func TestValidateLet(t *testing.T) {
+	type T struct {
+		A []int `vd:"@:let n = len($); n > 0 && n < 3; msg:sprintf('A has %v items', len($))"`
+		B int   `vd:"let d = (A)$[0]; let m = d * 2; $ >= d && $ <= m"`
+	}
+	v := vd.New("vd")
+	assert.NoError(t, v.Validate(&T{A: []int{2}, B: 3}))
+	assert.EqualError(t, v.Validate(&T{A: []int{1, 2, 3}, B: 1}), "A has 3 items")
+	assert.EqualError(t, v.Validate(&T{A: []int{2}, B: 5}), "invalid parameter: B")
+}